@@ -2,16 +2,17 @@ package balancer
 
 type Balancer interface {
 	// Add add an item to be selected.
-	// weight is only used for WeightedRoundRobin/SmoothWeightedRoundRobin/WeightedRand, default: 1
+	// weight is only used for WeightedRoundRobin/SmoothWeightedRoundRobin/WeightedRand/WeightedLeastConnections/RingHash/Maglev/Rendezvous and weighted ConsistentHash, default: 1
 	Add(item string, weight ...int)
 
 	// All get all items.
-	// RoundRobin/Random/ConsistentHash: []string
-	// WeightedRoundRobin/SmoothWeightedRoundRobin/WeightedRand: map[string]int
+	// ConsistentHash: []string or map[string]int, the same type as the items initialized
+	// RoundRobin/Random/LeastConnections/PowerOfTwoChoices/PeakEWMA: []string
+	// WeightedRoundRobin/SmoothWeightedRoundRobin/WeightedRand/WeightedLeastConnections/RingHash/Maglev/Rendezvous: map[string]int
 	All() interface{}
 
 	// Select gets next selected item.
-	// key is only used for ConsistentHash
+	// key is only used for ConsistentHash/RingHash/Maglev/Rendezvous
 	Select(key ...string) string
 
 	// Name load balancer name.
@@ -28,11 +29,60 @@ type Balancer interface {
 	Reset()
 
 	// Update reinitialize the balancer items.
-	// RoundRobin/Random/ConsistentHash: []string
-	// WeightedRoundRobin/SmoothWeightedRoundRobin/WeightedRand: map[string]int
+	// RoundRobin/WeightedRoundRobin/SmoothWeightedRoundRobin keep the rotation and the current weights of the retained items.
+	// ConsistentHash: []string or map[string]int
+	// RoundRobin/Random/LeastConnections/PowerOfTwoChoices/PeakEWMA: []string
+	// WeightedRoundRobin/SmoothWeightedRoundRobin/WeightedRand/WeightedLeastConnections/RingHash/Maglev/Rendezvous: map[string]int
 	Update(items interface{}) bool
 }
 
+// SelectorN is implemented by the balancers that get up to n distinct items at once, all the balancers of this package.
+type SelectorN interface {
+	Balancer
+
+	// SelectN gets up to n distinct items in the order of preference, e.g. for replicas or retries.
+	// The balancer moves on as a single Select.
+	SelectN(n int, key ...string) []string
+}
+
+// ExceptSelector is implemented by the balancers that select other than the excluded items,
+// all the balancers of this package.
+type ExceptSelector interface {
+	Balancer
+
+	// SelectExcept gets next selected item other than the excluded items, e.g. retry to a different item.
+	// The excluded items are passed over in the order of the balancer.
+	SelectExcept(exclude []string, key ...string) string
+}
+
+// Acquirer is implemented by the balancers that take the in-flight requests into account.
+type Acquirer interface {
+	Balancer
+
+	// Acquire gets next selected item and counts an in-flight request on it.
+	// done must be called when the request is finished.
+	Acquire(key ...string) (item string, done func())
+}
+
+// ExceptAcquirer is implemented by the Acquirers of this package and the health check/outlier detection/circuit breaker,
+// so that the wrappers pass over their items while counting the in-flight requests.
+type ExceptAcquirer interface {
+	Acquirer
+
+	// AcquireExcept gets next selected item other than the excluded items and counts an in-flight request on it.
+	AcquireExcept(exclude []string, key ...string) (item string, done func())
+}
+
+// Weighter is implemented by the weighted balancers that adjust the weight of an item in place:
+// WeightedRoundRobin/SmoothWeightedRoundRobin/WeightedRand/WeightedLeastConnections/Rendezvous.
+type Weighter interface {
+	Balancer
+
+	// SetWeight sets the weight of the item, adds it if not exists.
+	// The state of the items is kept, e.g. the current weights of SmoothWeightedRoundRobin.
+	SetWeight(item string, weight int)
+}
+
 // Mode defines the selectable balancer algorithm.
 type Mode int
 
@@ -44,6 +94,13 @@ const (
 	ConsistentHash
 	RoundRobin
 	Random
+	LeastConnections
+	WeightedLeastConnections
+	PowerOfTwoChoices
+	PeakEWMA
+	RingHash
+	Maglev
+	Rendezvous
 )
 
 func (m Mode) String() string {
@@ -60,14 +117,29 @@ func (m Mode) String() string {
 		return "RoundRobin"
 	case Random:
 		return "Random"
+	case LeastConnections:
+		return "LeastConnections"
+	case WeightedLeastConnections:
+		return "WeightedLeastConnections"
+	case PowerOfTwoChoices:
+		return "PowerOfTwoChoices"
+	case PeakEWMA:
+		return "PeakEWMA"
+	case RingHash:
+		return "RingHash"
+	case Maglev:
+		return "Maglev"
+	case Rendezvous:
+		return "Rendezvous"
 	default:
 		return ""
 	}
 }
 
 // New create a balancer with or without items.
-// RoundRobin/Random/ConsistentHash: []string
-// WeightedRoundRobin/SmoothWeightedRoundRobin/WeightedRand: map[string]int
+// ConsistentHash: []string or map[string]int
+// RoundRobin/Random/LeastConnections/PowerOfTwoChoices/PeakEWMA: []string
+// WeightedRoundRobin/SmoothWeightedRoundRobin/WeightedRand/WeightedLeastConnections/RingHash/Maglev/Rendezvous: map[string]int
 func New(b Mode, itemsMap map[string]int, itemsList []string) Balancer {
 	switch b {
 	case SmoothWeightedRoundRobin:
@@ -75,12 +147,192 @@ func New(b Mode, itemsMap map[string]int, itemsList []string) Balancer {
 	case WeightedRand:
 		return NewWeightedRand(itemsMap)
 	case ConsistentHash:
+		if itemsList == nil && itemsMap != nil {
+			return NewConsistentHash(itemsMap)
+		}
 		return NewConsistentHash(itemsList)
 	case RoundRobin:
 		return NewRoundRobin(itemsList)
 	case Random:
 		return NewRandom(itemsList)
+	case LeastConnections:
+		return NewLeastConnections(itemsList)
+	case WeightedLeastConnections:
+		return NewWeightedLeastConnections(itemsMap)
+	case PowerOfTwoChoices:
+		return NewPowerOfTwoChoices(itemsList)
+	case PeakEWMA:
+		return NewPeakEWMA(itemsList)
+	case RingHash:
+		return NewRingHash(itemsMap)
+	case Maglev:
+		return NewMaglev(itemsMap)
+	case Rendezvous:
+		return NewRendezvous(itemsMap)
 	default:
 		return NewWeightedRoundRobin(itemsMap)
 	}
 }
+
+// picker collects up to n distinct items.
+type picker struct {
+	items []string
+	seen  map[string]struct{}
+	n     int
+}
+
+func newPicker(n, max int) *picker {
+	if n > max {
+		n = max
+	}
+	if n < 0 {
+		n = 0
+	}
+	return &picker{
+		items: make([]string, 0, n),
+		seen:  make(map[string]struct{}, n),
+		n:     n,
+	}
+}
+
+// add adds the item if it has not been picked, reports whether n items have been picked.
+func (p *picker) add(item string) bool {
+	if len(p.items) < p.n {
+		if _, ok := p.seen[item]; !ok {
+			p.seen[item] = struct{}{}
+			p.items = append(p.items, item)
+		}
+	}
+	return p.full()
+}
+
+func (p *picker) full() bool {
+	return len(p.items) >= p.n
+}
+
+func (p *picker) result() []string {
+	if len(p.items) == 0 {
+		return nil
+	}
+	return p.items
+}
+
+// excluded returns a func that reports whether the item is in the list, nil for an empty list.
+func excluded(list []string) func(item string) bool {
+	switch len(list) {
+	case 0:
+		return nil
+	case 1:
+		x := list[0]
+		return func(item string) bool {
+			return item == x
+		}
+	}
+
+	m := make(map[string]struct{}, len(list))
+	for _, x := range list {
+		m[x] = struct{}{}
+	}
+	return func(item string) bool {
+		_, ok := m[item]
+		return ok
+	}
+}
+
+// selectExcept gets next selected item other than the excluded items,
+// by the repeated Select if the balancer is not an ExceptSelector.
+func selectExcept(lb Balancer, exclude []string, key ...string) string {
+	if s, ok := lb.(ExceptSelector); ok {
+		return s.SelectExcept(exclude, key...)
+	}
+
+	skip := excluded(exclude)
+	if skip == nil {
+		return lb.Select(key...)
+	}
+	for i, count := 0, len(itemsOf(lb.All())); i < count; i++ {
+		if item := lb.Select(key...); item != "" && !skip(item) {
+			return item
+		}
+	}
+	return ""
+}
+
+// acquireExcept gets next selected item other than the excluded items and counts an in-flight request on it,
+// done is a no-op if the balancer does not count the in-flight requests.
+func acquireExcept(lb Balancer, exclude []string, key ...string) (string, func()) {
+	if a, ok := lb.(ExceptAcquirer); ok {
+		return a.AcquireExcept(exclude, key...)
+	}
+	if a, ok := lb.(Acquirer); ok && len(exclude) == 0 {
+		return a.Acquire(key...)
+	}
+	return selectExcept(lb, exclude, key...), noop
+}
+
+// selectN gets up to n distinct items of the balancer, by the repeated Select if it is not a SelectorN.
+func selectN(lb Balancer, n int, key ...string) []string {
+	if s, ok := lb.(SelectorN); ok {
+		return s.SelectN(n, key...)
+	}
+
+	count := len(itemsOf(lb.All()))
+	p := newPicker(n, count)
+	for i := 0; i < count && !p.full(); i++ {
+		if item := lb.Select(key...); item != "" {
+			p.add(item)
+		}
+	}
+	return p.result()
+}
+
+// selectNExcept gets up to n distinct items of the balancer other than the excluded items.
+func selectNExcept(lb Balancer, n int, exclude []string, key ...string) []string {
+	skip := excluded(exclude)
+	if skip == nil {
+		return selectN(lb, n, key...)
+	}
+
+	// no more than all the items, n+len(exclude) overflows for a huge n
+	if count := len(itemsOf(lb.All())); n > count {
+		n = count
+	}
+
+	var items []string
+	for _, item := range selectN(lb, n+len(exclude), key...) {
+		if !skip(item) && len(items) < n {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// itemsOf gets the items of All(), []string or the keys of map[string]int.
+func itemsOf(all interface{}) []string {
+	switch v := all.(type) {
+	case []string:
+		return v
+	case map[string]int:
+		items := make([]string, 0, len(v))
+		for item := range v {
+			items = append(items, item)
+		}
+		return items
+	}
+	return nil
+}
+
+// weightsOf gets the weights of All() of a balancer.
+func weightsOf(all interface{}) map[string]int {
+	switch v := all.(type) {
+	case map[string]int:
+		return v
+	case []string:
+		weights := make(map[string]int, len(v))
+		for _, item := range v {
+			weights[item]++
+		}
+		return weights
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package balancer
 
 import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
 	"testing"
 )
 
@@ -35,6 +39,41 @@ func TestBalancer(t *testing.T) {
 		t.Fatal("balancer.New wrong")
 	}
 
+	lb = New(LeastConnections, nil, nil)
+	if lb.Name() != "LeastConnections" || lb.Name() != LeastConnections.String() {
+		t.Fatal("balancer.New wrong")
+	}
+
+	lb = New(WeightedLeastConnections, nil, nil)
+	if lb.Name() != "WeightedLeastConnections" || lb.Name() != WeightedLeastConnections.String() {
+		t.Fatal("balancer.New wrong")
+	}
+
+	lb = New(PowerOfTwoChoices, nil, nil)
+	if lb.Name() != "PowerOfTwoChoices" || lb.Name() != PowerOfTwoChoices.String() {
+		t.Fatal("balancer.New wrong")
+	}
+
+	lb = New(PeakEWMA, nil, nil)
+	if lb.Name() != "PeakEWMA" || lb.Name() != PeakEWMA.String() {
+		t.Fatal("balancer.New wrong")
+	}
+
+	lb = New(RingHash, nil, nil)
+	if lb.Name() != "RingHash" || lb.Name() != RingHash.String() {
+		t.Fatal("balancer.New wrong")
+	}
+
+	lb = New(Maglev, nil, nil)
+	if lb.Name() != "Maglev" || lb.Name() != Maglev.String() {
+		t.Fatal("balancer.New wrong")
+	}
+
+	lb = New(Rendezvous, nil, nil)
+	if lb.Name() != "Rendezvous" || lb.Name() != Rendezvous.String() {
+		t.Fatal("balancer.New wrong")
+	}
+
 	if Mode(777).String() != "" {
 		t.Fatal("balancer name wrong")
 	}
@@ -45,3 +84,307 @@ func TestBalancer(t *testing.T) {
 		t.Fatal("balancer select wrong")
 	}
 }
+
+func TestBalancer_SelectN(t *testing.T) {
+	wNodes := map[string]int{
+		"A": 1,
+		"B": 2,
+		"C": 3,
+		"D": 4,
+		"E": 0,
+	}
+	nodes := []string{"A", "B", "C", "D"}
+	for m := WeightedRoundRobin; m <= Rendezvous; m++ {
+		lb := New(m, nil, nil).(SelectorN)
+		if items := lb.SelectN(2, "192.168.1.100"); items != nil {
+			t.Fatalf("%s expected nil, actual %v", m, items)
+		}
+
+		lb = New(m, wNodes, nodes).(SelectorN)
+		if items := lb.SelectN(0, "192.168.1.100"); items != nil {
+			t.Fatalf("%s expected nil, actual %v", m, items)
+		}
+		if items := lb.SelectN(-1, "192.168.1.100"); items != nil {
+			t.Fatalf("%s expected nil, actual %v", m, items)
+		}
+		for i := 0; i < 100; i++ {
+			items := lb.SelectN(2, "192.168.1.100")
+			if len(items) != 2 || items[0] == items[1] {
+				t.Fatalf("%s select n wrong: %v", m, items)
+			}
+			items = lb.SelectN(10, "192.168.1.100")
+			seen := make(map[string]bool)
+			for _, v := range items {
+				seen[v] = true
+			}
+			if len(items) != 4 || len(seen) != 4 || seen["E"] {
+				t.Fatalf("%s select n wrong: %v", m, items)
+			}
+		}
+	}
+}
+
+// plain is a Balancer implementing none of the optional interfaces.
+type plain struct {
+	Balancer
+}
+
+func TestBalancer_SelectN_Fallback(t *testing.T) {
+	lb := plain{NewRoundRobin([]string{"A", "B", "C"})}
+	if _, ok := Balancer(lb).(SelectorN); ok {
+		t.Fatal("plain select n wrong")
+	}
+	items := selectN(lb, 2)
+	if len(items) != 2 || items[0] == items[1] {
+		t.Fatalf("plain select n wrong: %v", items)
+	}
+	if items = selectN(lb, 5); len(items) != 3 {
+		t.Fatalf("plain select n wrong: %v", items)
+	}
+	if items = selectNExcept(lb, 5, []string{"B"}); len(items) != 2 {
+		t.Fatalf("plain select n wrong: %v", items)
+	}
+	if items = selectNExcept(lb, int(^uint(0)>>1), []string{"B"}); len(items) != 2 {
+		t.Fatalf("plain select n wrong: %v", items)
+	}
+	if items = selectN(plain{NewRoundRobin()}, 2); items != nil {
+		t.Fatalf("plain expected nil, actual %v", items)
+	}
+}
+
+func TestBalancer_SelectExcept_Fallback(t *testing.T) {
+	lb := plain{NewRoundRobin([]string{"A", "B", "C"})}
+	if _, ok := Balancer(lb).(ExceptSelector); ok {
+		t.Fatal("plain select except wrong")
+	}
+	for i := 0; i < 10; i++ {
+		if item := selectExcept(lb, []string{"A", "C"}); item != "B" {
+			t.Fatalf("plain expected B, actual %s", item)
+		}
+	}
+	if item := selectExcept(lb, []string{"A", "B", "C"}); item != "" {
+		t.Fatalf("plain expected empty, actual %s", item)
+	}
+
+	// the wrappers fall back too
+	od := NewOutlierDetection(lb)
+	od.SetConsecutiveErrors(1)
+	od.Failure("A")
+	for i := 0; i < 10; i++ {
+		if item := od.Select(); item == "A" || item == "" {
+			t.Fatalf("plain outlier detection wrong: %s", item)
+		}
+	}
+}
+
+func TestBalancer_SelectExcept(t *testing.T) {
+	wNodes := map[string]int{
+		"A": 1,
+		"B": 2,
+		"C": 3,
+		"D": 4,
+		"E": 0,
+	}
+	nodes := []string{"A", "B", "C", "D"}
+	for m := WeightedRoundRobin; m <= Rendezvous; m++ {
+		lb := New(m, nil, nil).(ExceptSelector)
+		if item := lb.SelectExcept([]string{"A"}, "192.168.1.100"); item != "" {
+			t.Fatalf("%s expected empty, actual %s", m, item)
+		}
+
+		lb = New(m, wNodes, nodes).(ExceptSelector)
+		for i := 0; i < 100; i++ {
+			key := strconv.Itoa(i)
+			item := lb.SelectExcept([]string{"A", "B", "X"}, key)
+			if item != "C" && item != "D" {
+				t.Fatalf("%s select except wrong: %s", m, item)
+			}
+			item = lb.SelectExcept([]string{"D", "C", "B", "A"}, key)
+			if item != "" {
+				t.Fatalf("%s expected empty, actual %s", m, item)
+			}
+			item = lb.SelectExcept(nil, key)
+			if item == "" || item == "E" {
+				t.Fatalf("%s select except wrong: %s", m, item)
+			}
+		}
+	}
+}
+
+func TestBalancer_AcquireExcept(t *testing.T) {
+	nodes := []string{"A", "B", "C"}
+	hc := NewHealthCheck(NewLeastConnections(nodes), func(_ context.Context, item string) error {
+		if item == "A" {
+			return errors.New("down")
+		}
+		return nil
+	})
+	hc.SetThreshold(1, 1)
+	hc.Check()
+	od := NewOutlierDetection(NewWeightedLeastConnections(map[string]int{"A": 1, "B": 1, "C": 1}))
+	od.SetConsecutiveErrors(1)
+	od.Failure("A")
+	cb := NewCircuitBreaker(NewPeakEWMA(nodes))
+	cb.SetFailureRatio(1, 1)
+	cb.Failure("A")
+	inner := NewOutlierDetection(NewPowerOfTwoChoices(nodes))
+	inner.SetConsecutiveErrors(1)
+	inner.Failure("A")
+
+	// the wrappers pass over their items while counting the in-flight requests
+	for _, lb := range []ExceptAcquirer{hc, od, cb, NewCircuitBreaker(inner)} {
+		count := make(map[string]int)
+		var dones []func()
+		for i := 0; i < 10; i++ {
+			item, done := lb.Acquire()
+			count[item]++
+			dones = append(dones, done)
+		}
+		if count["B"] != 5 || count["C"] != 5 {
+			t.Fatalf("%s acquire wrong: %v", lb.Name(), count)
+		}
+		item, done := lb.AcquireExcept([]string{"B"})
+		if item != "C" {
+			t.Fatalf("%s expected C, actual %s", lb.Name(), item)
+		}
+		done()
+		for _, done := range dones {
+			done()
+		}
+		if item, done = lb.AcquireExcept([]string{"B", "C"}); item != "" {
+			t.Fatalf("%s expected empty, actual %s", lb.Name(), item)
+		}
+		done()
+	}
+
+	// done is a no-op if the balancer does not count the in-flight requests
+	od = NewOutlierDetection(NewRoundRobin(nodes))
+	od.SetConsecutiveErrors(1)
+	od.Failure("A")
+	for i := 0; i < 10; i++ {
+		item, done := od.Acquire()
+		if item == "A" || item == "" {
+			t.Fatalf("outlier acquire wrong: %s", item)
+		}
+		done()
+	}
+}
+
+func TestBalancer_PanicThreshold(t *testing.T) {
+	wNodes := map[string]int{
+		"A": 1,
+		"B": 2,
+		"C": 3,
+		"D": 4,
+	}
+	nodes := []string{"A", "B", "C", "D"}
+	for m := WeightedRoundRobin; m <= Rendezvous; m++ {
+		down := map[string]bool{"A": true, "B": true}
+		hc := NewHealthCheck(New(m, wNodes, nodes), func(ctx context.Context, item string) error {
+			if down[item] {
+				return errors.New("down")
+			}
+			return nil
+		})
+		hc.SetThreshold(1, 1)
+		hc.SetPanicThreshold(0.5)
+		od := NewOutlierDetection(New(m, wNodes, nodes))
+		od.SetConsecutiveErrors(1)
+		od.SetPanicThreshold(0.5)
+		od.Failure("A")
+		od.Failure("B")
+
+		// half of the items are healthy
+		hc.Check()
+		for _, lb := range []interface {
+			Balancer
+			Status() HealthStatus
+		}{hc, od} {
+			status := lb.Status()
+			if status.Total != 4 || len(status.Unhealthy) != 2 || status.Panic {
+				t.Fatalf("%s status wrong: %v", m, status)
+			}
+			for i := 0; i < 100; i++ {
+				item := lb.Select(strconv.Itoa(i))
+				if item != "C" && item != "D" {
+					t.Fatalf("%s panic threshold wrong: %s", m, item)
+				}
+			}
+		}
+
+		// too few healthy items, selects across all the items
+		down["C"] = true
+		hc.Check()
+		od.Failure("C")
+		for _, lb := range []interface {
+			SelectorN
+			Status() HealthStatus
+		}{hc, od} {
+			status := lb.Status()
+			if status.Total != 4 || len(status.Unhealthy) != 3 || !status.Panic {
+				t.Fatalf("%s status wrong: %v", m, status)
+			}
+			seen := make(map[string]bool)
+			for i := 0; i < 100; i++ {
+				seen[lb.Select(strconv.Itoa(i))] = true
+			}
+			if !seen["A"] || !seen["B"] || !seen["C"] || !seen["D"] {
+				t.Fatalf("%s panic mode wrong: %v", m, seen)
+			}
+			if items := lb.SelectN(4); len(items) != 4 {
+				t.Fatalf("%s panic mode wrong: %v", m, items)
+			}
+		}
+	}
+}
+
+func TestBalancer_SetWeight(t *testing.T) {
+	for m := WeightedRoundRobin; m <= Rendezvous; m++ {
+		lb, ok := New(m, map[string]int{"A": 1, "B": 1}, nil).(Weighter)
+		if !ok {
+			continue
+		}
+		lb.SetWeight("A", 3)
+		lb.SetWeight("C", 1)
+		lb.SetWeight("B", 0)
+		all := lb.All().(map[string]int)
+		if len(all) != 3 || all["A"] != 3 || all["B"] != 0 || all["C"] != 1 {
+			t.Fatalf("%s set weight wrong: %v", m, all)
+		}
+		count := make(map[string]int)
+		for i := 0; i < 4000; i++ {
+			count[lb.Select(strconv.Itoa(i))]++
+		}
+		if count["B"] != 0 || count["A"] < 2500 || count["C"] < 700 {
+			t.Fatalf("%s set weight wrong: %v", m, count)
+		}
+	}
+}
+
+func TestBalancer_Snapshot_C(t *testing.T) {
+	wNodes := [2]map[string]int{{"A": 1, "B": 2}, {"C": 1, "D": 2}}
+	nodes := [2][]string{{"A", "B"}, {"C", "D"}}
+	for _, m := range []Mode{WeightedRand, ConsistentHash, Random} {
+		lb := New(m, wNodes[0], nodes[0])
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					if i == 0 && j%10 == 0 {
+						if !lb.Update(wNodes[j/10%2]) {
+							lb.Update(nodes[j/10%2])
+						}
+						continue
+					}
+					if lb.Select(strconv.Itoa(j)) == "" {
+						t.Errorf("%s snapshot wrong", m)
+						return
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+	}
+}
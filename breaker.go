@@ -0,0 +1,359 @@
+package balancer
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFailureRatio is the default failure ratio to open the circuit of an item.
+	DefaultFailureRatio = 0.5
+
+	// DefaultMinRequests is the default min number of requests in an interval to calculate the failure ratio.
+	DefaultMinRequests = 20
+
+	// DefaultBreakerInterval is the default interval of the failure ratio statistics.
+	DefaultBreakerInterval = 10 * time.Second
+
+	// DefaultOpenTimeout is the default time of an open circuit before it turns half-open.
+	DefaultOpenTimeout = 30 * time.Second
+
+	// DefaultHalfOpenTrials is the default number of trial requests of a half-open circuit.
+	DefaultHalfOpenTrials = 3
+)
+
+// CircuitState is the state of the circuit of an item.
+type CircuitState int
+
+const (
+	// StateClosed the requests pass.
+	StateClosed CircuitState = iota
+	// StateOpen the requests are rejected.
+	StateOpen
+	// StateHalfOpen a limited number of trial requests pass.
+	StateHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case StateClosed:
+		return "Closed"
+	case StateOpen:
+		return "Open"
+	case StateHalfOpen:
+		return "HalfOpen"
+	}
+	return ""
+}
+
+// CircuitBreaker
+// Wraps a balancer with a circuit breaker per item. The circuit opens when the failure ratio of an interval
+// reaches the threshold, turns half-open after the open timeout, and closes again after the trial requests
+// all succeed. Open items, and half-open items out of trials, are passed over by SelectExcept of the balancer.
+// Ref: https://martinfowler.com/bliki/CircuitBreaker.html
+type circuitBreaker struct {
+	Balancer
+
+	ratio       float64
+	minRequests int
+	interval    time.Duration
+	openTimeout time.Duration
+	trials      int
+
+	breakers map[string]*breaker
+	tripped  map[string]*breaker
+
+	// the clock, replaced by the tests
+	now func() time.Time
+
+	sync.Mutex
+}
+
+type breaker struct {
+	state     CircuitState
+	successes int
+	failures  int
+	trials    int
+	since     time.Time
+}
+
+// NewCircuitBreaker wraps the balancer with the circuit breakers,
+// by default a circuit opens at 50% failures of at least 20 requests in 10s, for 30s.
+func NewCircuitBreaker(lb Balancer) *circuitBreaker {
+	return &circuitBreaker{
+		Balancer:    lb,
+		ratio:       DefaultFailureRatio,
+		minRequests: DefaultMinRequests,
+		interval:    DefaultBreakerInterval,
+		openTimeout: DefaultOpenTimeout,
+		trials:      DefaultHalfOpenTrials,
+		breakers:    make(map[string]*breaker),
+		tripped:     make(map[string]*breaker),
+		now:         time.Now,
+	}
+}
+
+// SetFailureRatio sets the failure ratio (0, 1] to open the circuit, counted in each interval
+// once the item has at least minRequests reports.
+func (b *circuitBreaker) SetFailureRatio(ratio float64, minRequests int, interval ...time.Duration) {
+	if ratio <= 0 || ratio > 1 {
+		ratio = DefaultFailureRatio
+	}
+	if minRequests < 1 {
+		minRequests = 1
+	}
+	b.Lock()
+	b.ratio = ratio
+	b.minRequests = minRequests
+	if len(interval) > 0 && interval[0] > 0 {
+		b.interval = interval[0]
+	}
+	b.Unlock()
+}
+
+// SetOpenTimeout sets the time of an open circuit before it turns half-open.
+func (b *circuitBreaker) SetOpenTimeout(d time.Duration) {
+	if d <= 0 {
+		d = DefaultOpenTimeout
+	}
+	b.Lock()
+	b.openTimeout = d
+	b.Unlock()
+}
+
+// SetHalfOpenTrials sets the number of trial requests of a half-open circuit,
+// they must all succeed to close the circuit.
+func (b *circuitBreaker) SetHalfOpenTrials(n int) {
+	if n < 1 {
+		n = DefaultHalfOpenTrials
+	}
+	b.Lock()
+	b.trials = n
+	b.Unlock()
+}
+
+// State gets the circuit state of the item.
+func (b *circuitBreaker) State(item string) CircuitState {
+	b.Lock()
+	defer b.Unlock()
+
+	if c, ok := b.tripped[item]; ok {
+		b.advance(c, b.now())
+		return c.state
+	}
+	return StateClosed
+}
+
+// Success reports a successful request to the item.
+func (b *circuitBreaker) Success(item string) {
+	b.report(item, true)
+}
+
+// Failure reports a failed request to the item.
+func (b *circuitBreaker) Failure(item string) {
+	b.report(item, false)
+}
+
+func (b *circuitBreaker) report(item string, ok bool) {
+	b.Lock()
+	_, found := b.breakers[item]
+	b.Unlock()
+
+	// the reports of the items not in the balancer are ignored
+	if !found {
+		if _, in := weightsOf(b.Balancer.All())[item]; !in {
+			return
+		}
+	}
+
+	now := b.now()
+
+	b.Lock()
+	defer b.Unlock()
+
+	c, found := b.breakers[item]
+	if !found {
+		c = &breaker{since: now}
+		b.breakers[item] = c
+	}
+	b.advance(c, now)
+
+	switch c.state {
+	case StateClosed:
+		if now.Sub(c.since) >= b.interval {
+			c.successes, c.failures, c.since = 0, 0, now
+		}
+		if ok {
+			c.successes++
+			return
+		}
+		c.failures++
+		total := c.successes + c.failures
+		if total >= b.minRequests && float64(c.failures) >= b.ratio*float64(total) {
+			b.open(item, c, now)
+		}
+	case StateHalfOpen:
+		if !ok {
+			b.open(item, c, now)
+			return
+		}
+		c.successes++
+		if c.successes >= b.trials {
+			c.state = StateClosed
+			c.successes, c.failures, c.trials, c.since = 0, 0, 0, now
+			delete(b.tripped, item)
+		}
+	}
+}
+
+func (b *circuitBreaker) open(item string, c *breaker, now time.Time) {
+	c.state = StateOpen
+	c.successes, c.failures, c.trials, c.since = 0, 0, 0, now
+	b.tripped[item] = c
+}
+
+// advance turns an open circuit half-open after the open timeout,
+// and renews the trials of a half-open circuit not reported within the open timeout.
+func (b *circuitBreaker) advance(c *breaker, now time.Time) {
+	if c.state == StateClosed || now.Sub(c.since) < b.openTimeout {
+		return
+	}
+	switch c.state {
+	case StateOpen:
+		c.state = StateHalfOpen
+		c.successes, c.trials, c.since = 0, 0, now
+	case StateHalfOpen:
+		if c.trials >= b.trials {
+			c.successes, c.trials, c.since = 0, 0, now
+		}
+	}
+}
+
+// rejected gets the items of open circuits and half-open circuits out of trials.
+func (b *circuitBreaker) rejected() []string {
+	b.Lock()
+	defer b.Unlock()
+
+	if len(b.tripped) == 0 {
+		return nil
+	}
+	now := b.now()
+	var items []string
+	for item, c := range b.tripped {
+		b.advance(c, now)
+		if c.state == StateOpen || c.trials >= b.trials {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// allow reports whether a request can be sent to the item, and takes a trial of a half-open circuit.
+func (b *circuitBreaker) allow(item string) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	c, ok := b.tripped[item]
+	if !ok {
+		return true
+	}
+	b.advance(c, b.now())
+	if c.state == StateHalfOpen && c.trials < b.trials {
+		c.trials++
+		return true
+	}
+	return false
+}
+
+// Select gets next selected item other than the items of which the circuit rejects the request.
+// Selecting a half-open item takes one of its trials.
+func (b *circuitBreaker) Select(key ...string) string {
+	return b.SelectExcept(nil, key...)
+}
+
+// SelectN gets up to n distinct items other than the items of which the circuit rejects the request.
+func (b *circuitBreaker) SelectN(n int, key ...string) []string {
+	rejected := b.rejected()
+	var items []string
+	for _, item := range selectNExcept(b.Balancer, n, rejected, key...) {
+		if b.allow(item) {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// SelectExcept gets next selected item other than the excluded items
+// and the items of which the circuit rejects the request.
+func (b *circuitBreaker) SelectExcept(exclude []string, key ...string) string {
+	exclude = append(exclude[:len(exclude):len(exclude)], b.rejected()...)
+	for {
+		item := selectExcept(b.Balancer, exclude, key...)
+		if item == "" || b.allow(item) {
+			return item
+		}
+		// the trials of the item were taken in the meantime
+		exclude = append(exclude, item)
+	}
+}
+
+// Acquire gets next selected item other than the items of which the circuit rejects the request,
+// and counts an in-flight request on it, done is a no-op if the balancer does not count the in-flight requests.
+func (b *circuitBreaker) Acquire(key ...string) (string, func()) {
+	return b.AcquireExcept(nil, key...)
+}
+
+// AcquireExcept gets next selected item other than the excluded items
+// and the items of which the circuit rejects the request, and counts an in-flight request on it.
+func (b *circuitBreaker) AcquireExcept(exclude []string, key ...string) (string, func()) {
+	exclude = append(exclude[:len(exclude):len(exclude)], b.rejected()...)
+	for {
+		item, done := acquireExcept(b.Balancer, exclude, key...)
+		if item == "" || b.allow(item) {
+			return item, done
+		}
+		// the trials of the item were taken in the meantime
+		done()
+		exclude = append(exclude, item)
+	}
+}
+
+func (b *circuitBreaker) Remove(item string, asClean ...bool) bool {
+	b.Lock()
+	delete(b.breakers, item)
+	delete(b.tripped, item)
+	b.Unlock()
+
+	return b.Balancer.Remove(item, asClean...)
+}
+
+func (b *circuitBreaker) RemoveAll() {
+	b.Lock()
+	b.breakers = make(map[string]*breaker)
+	b.tripped = make(map[string]*breaker)
+	b.Unlock()
+
+	b.Balancer.RemoveAll()
+}
+
+// Update reinitializes the items, the circuits of the removed items are forgotten.
+func (b *circuitBreaker) Update(items interface{}) bool {
+	ok := b.Balancer.Update(items)
+	b.prune()
+
+	return ok
+}
+
+// prune removes the circuits of the items not in the balancer.
+func (b *circuitBreaker) prune() {
+	all := weightsOf(b.Balancer.All())
+
+	b.Lock()
+	for item := range b.breakers {
+		if _, ok := all[item]; !ok {
+			delete(b.breakers, item)
+			delete(b.tripped, item)
+		}
+	}
+	b.Unlock()
+}
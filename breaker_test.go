@@ -0,0 +1,183 @@
+package balancer
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	lb := NewCircuitBreaker(NewSmoothWeightedRoundRobin(map[string]int{
+		"A": 1,
+		"B": 2,
+		"C": 3,
+	}))
+	if lb.Name() != "SmoothWeightedRoundRobin" || lb.State("C") != StateClosed {
+		t.Fatal("breaker wrong")
+	}
+	clock := newFakeClock()
+	lb.now = clock.Now
+	lb.SetFailureRatio(0.5, 10)
+	lb.SetOpenTimeout(50 * time.Millisecond)
+	lb.SetHalfOpenTrials(2)
+
+	// closed
+	for i := 0; i < 4; i++ {
+		lb.Success("C")
+		lb.Failure("C")
+	}
+	if lb.State("C") != StateClosed {
+		t.Fatal("breaker closed wrong")
+	}
+
+	// open
+	lb.Success("C")
+	lb.Failure("C")
+	if lb.State("C") != StateOpen || lb.State("C").String() != "Open" {
+		t.Fatal("breaker open wrong")
+	}
+	items := ""
+	for i := 0; i < 6; i++ {
+		items += lb.Select()
+	}
+	if items != "BABBAB" {
+		t.Fatalf("breaker expected BABBAB, actual %s", items)
+	}
+	if got := lb.SelectN(3); len(got) != 2 {
+		t.Fatalf("breaker select n wrong: %v", got)
+	}
+
+	// half-open, only the trials pass
+	clock.Add(60 * time.Millisecond)
+	if lb.State("C") != StateHalfOpen {
+		t.Fatal("breaker half-open wrong")
+	}
+	count := make(map[string]int)
+	for i := 0; i < 60; i++ {
+		count[lb.Select()]++
+	}
+	if count["C"] != 2 || count["A"]+count["B"] != 58 {
+		t.Fatalf("breaker half-open wrong: %v", count)
+	}
+
+	// a failed trial opens the circuit again
+	lb.Success("C")
+	lb.Failure("C")
+	if lb.State("C") != StateOpen {
+		t.Fatal("breaker reopen wrong")
+	}
+
+	// the trials all succeed
+	clock.Add(60 * time.Millisecond)
+	item := lb.SelectExcept([]string{"A", "B"})
+	if item != "C" {
+		t.Fatalf("breaker expected C, actual %s", item)
+	}
+	lb.Success("C")
+	if lb.State("C") != StateHalfOpen {
+		t.Fatal("breaker half-open wrong")
+	}
+	lb.Success("C")
+	if lb.State("C") != StateClosed {
+		t.Fatal("breaker close wrong")
+	}
+	count = make(map[string]int)
+	for i := 0; i < 60; i++ {
+		count[lb.Select()]++
+	}
+	if count["A"] != 10 || count["B"] != 20 || count["C"] != 30 {
+		t.Fatalf("breaker close wrong: %v", count)
+	}
+
+	// the trials not reported are renewed after the open timeout
+	for i := 0; i < 10; i++ {
+		lb.Failure("A")
+	}
+	clock.Add(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if item := lb.SelectExcept([]string{"B", "C"}); item != "A" {
+			t.Fatalf("breaker expected A, actual %s", item)
+		}
+	}
+	if item := lb.SelectExcept([]string{"B", "C"}); item != "" {
+		t.Fatalf("breaker expected empty, actual %s", item)
+	}
+	clock.Add(60 * time.Millisecond)
+	if item := lb.SelectExcept([]string{"B", "C"}); item != "A" {
+		t.Fatalf("breaker expected A, actual %s", item)
+	}
+
+	ok := lb.Remove("A")
+	if ok != true || lb.State("A") != StateClosed {
+		t.Fatal("breaker remove() wrong")
+	}
+	lb.RemoveAll()
+	if len(lb.All().(map[string]int)) != 0 {
+		t.Fatal("breaker remove all wrong")
+	}
+}
+
+func TestCircuitBreaker_Update(t *testing.T) {
+	lb := NewCircuitBreaker(NewRoundRobin([]string{"A", "B", "C"}))
+	lb.SetFailureRatio(0.5, 1)
+	lb.Failure("A")
+	lb.Success("B")
+
+	// the items not in the balancer are ignored
+	lb.Failure("X")
+	if len(lb.breakers) != 2 || lb.State("A") != StateOpen || lb.State("X") != StateClosed {
+		t.Fatalf("circuit breaker wrong: %v", lb.breakers)
+	}
+
+	// and the removed items are forgotten
+	lb.Update([]string{"B", "C", "D"})
+	if len(lb.breakers) != 1 || lb.breakers["B"] == nil || len(lb.tripped) != 0 {
+		t.Fatalf("circuit breaker update wrong: %v", lb.breakers)
+	}
+
+	lb.Update([]string{"A", "B"})
+	if lb.State("A") != StateClosed {
+		t.Fatal("circuit breaker update wrong")
+	}
+	for i := 0; i < 10; i++ {
+		if item := lb.Select(); item == "" {
+			t.Fatal("circuit breaker update wrong")
+		}
+	}
+}
+
+func TestCircuitBreaker_C(t *testing.T) {
+	var c int64
+	lb := NewCircuitBreaker(NewWeightedRoundRobin(map[string]int{
+		"A": 1,
+		"B": 2,
+		"C": 3,
+	}))
+	clock := newFakeClock()
+	lb.now = clock.Now
+	lb.SetFailureRatio(1, 1)
+	lb.SetOpenTimeout(100 * time.Millisecond)
+	lb.SetHalfOpenTrials(5)
+	lb.Failure("C")
+	clock.Add(110 * time.Millisecond)
+
+	// within the open timeout of the half-open circuit
+	var wg sync.WaitGroup
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if lb.Select() == "C" {
+					atomic.AddInt64(&c, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt64(&c) != 5 {
+		t.Fatalf("breaker expected C == 5, actual %d", atomic.LoadInt64(&c))
+	}
+}
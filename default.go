@@ -18,6 +18,16 @@ func Select(_ ...string) string {
 	return DefaultBalancer.Select()
 }
 
+// SelectN gets up to n distinct items in the order of preference.
+func SelectN(n int, key ...string) []string {
+	return DefaultBalancer.SelectN(n, key...)
+}
+
+// SelectExcept gets next selected item other than the excluded items.
+func SelectExcept(exclude []string, key ...string) string {
+	return DefaultBalancer.SelectExcept(exclude, key...)
+}
+
 // Name load balancer name.
 func Name() string {
 	return DefaultBalancer.Name()
@@ -93,6 +93,32 @@ func TestDefaultBalancer(t *testing.T) {
 	RemoveAll()
 }
 
+func TestDefaultBalancer_SelectN(t *testing.T) {
+	Update(map[string]int{
+		"A": 1,
+		"B": 1,
+	})
+	items := SelectN(3)
+	if len(items) != 2 || items[0] == items[1] {
+		t.Fatalf("default balancer select n wrong: %v", items)
+	}
+	RemoveAll()
+}
+
+func TestDefaultBalancer_SelectExcept(t *testing.T) {
+	Update(map[string]int{
+		"A": 1,
+		"B": 1,
+	})
+	for i := 0; i < 10; i++ {
+		item := SelectExcept([]string{"A"})
+		if item != "B" {
+			t.Fatalf("default balancer expected B, actual %s", item)
+		}
+	}
+	RemoveAll()
+}
+
 func TestDefaultBalancer_C(t *testing.T) {
 	var (
 		a, b, c, d int64
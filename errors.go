@@ -0,0 +1,71 @@
+package balancer
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNoItems the balancer has no items.
+	ErrNoItems = errors.New("balancer: no items")
+
+	// ErrZeroWeights all weights of the items are zero.
+	ErrZeroWeights = errors.New("balancer: all weights are zero")
+
+	// ErrItemsType the type of the items is not the one of the balancer.
+	ErrItemsType = errors.New("balancer: wrong items type")
+
+	// ErrUnhealthy all items are unhealthy, ejected, or rejected by the circuit breakers.
+	ErrUnhealthy = errors.New("balancer: no healthy items")
+)
+
+// TrySelect gets next selected item of the balancer, or the error why there is no item to select:
+// ErrNoItems, ErrZeroWeights or ErrUnhealthy.
+func TrySelect(lb Balancer, key ...string) (string, error) {
+	if item := lb.Select(key...); item != "" {
+		return item, nil
+	}
+	return "", selectErr(lb)
+}
+
+// TryUpdate reinitializes the items of the balancer, ErrItemsType if the type of the items is wrong.
+func TryUpdate(lb Balancer, items interface{}) error {
+	if !lb.Update(items) {
+		return fmt.Errorf("%w: %T for %s", ErrItemsType, items, lb.Name())
+	}
+	return nil
+}
+
+// selectErr tells why the balancer selects no item.
+func selectErr(lb Balancer) error {
+	switch v := lb.All().(type) {
+	case []string:
+		if len(v) == 0 {
+			return ErrNoItems
+		}
+	case map[string]int:
+		if len(v) == 0 {
+			return ErrNoItems
+		}
+		zero := true
+		for _, w := range v {
+			if w > 0 {
+				zero = false
+				break
+			}
+		}
+		if zero {
+			return ErrZeroWeights
+		}
+	}
+
+	switch v := lb.(type) {
+	case *healthCheck, *outlierDetection, *circuitBreaker:
+		return ErrUnhealthy
+	case *notifier:
+		return selectErr(v.Balancer)
+	case *labeled:
+		return selectErr(v.Balancer)
+	}
+	return ErrNoItems
+}
@@ -0,0 +1,75 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTrySelect(t *testing.T) {
+	zero := map[string]int{
+		"A": 0,
+		"B": 0,
+	}
+	for m := WeightedRoundRobin; m <= Rendezvous; m++ {
+		lb := New(m, nil, nil)
+		item, err := TrySelect(lb, "192.168.1.100")
+		if item != "" || !errors.Is(err, ErrNoItems) {
+			t.Fatalf("%s expected ErrNoItems, actual %v", m, err)
+		}
+
+		lb = New(m, zero, nil)
+		item, err = TrySelect(lb, "192.168.1.100")
+		expected := ErrNoItems
+		if _, ok := lb.All().(map[string]int); ok {
+			expected = ErrZeroWeights
+		}
+		if item != "" || err != expected {
+			t.Fatalf("%s expected %v, actual %v", m, expected, err)
+		}
+
+		lb = New(m, map[string]int{"A": 1}, []string{"A"})
+		item, err = TrySelect(lb, "192.168.1.100")
+		if item != "A" || err != nil {
+			t.Fatalf("%s expected A, actual %s, %v", m, item, err)
+		}
+	}
+
+	od := NewOutlierDetection(NewRoundRobin([]string{"A"}))
+	od.SetConsecutiveErrors(1)
+	od.Failure("A")
+	cb := NewCircuitBreaker(NewSmoothWeightedRoundRobin(map[string]int{"A": 1}))
+	cb.SetFailureRatio(1, 1)
+	cb.Failure("A")
+	hc := NewHealthCheck(NewRandom([]string{"A"}), func(context.Context, string) error {
+		return errors.New("down")
+	})
+	hc.SetThreshold(1, 1)
+	hc.Check()
+	for _, lb := range []Balancer{od, cb, hc} {
+		_, err := TrySelect(lb)
+		if !errors.Is(err, ErrUnhealthy) {
+			t.Fatalf("%s expected ErrUnhealthy, actual %v", lb.Name(), err)
+		}
+	}
+	_, err := TrySelect(NewOutlierDetection(NewRoundRobin()))
+	if !errors.Is(err, ErrNoItems) {
+		t.Fatalf("outlier expected ErrNoItems, actual %v", err)
+	}
+}
+
+func TestTryUpdate(t *testing.T) {
+	for m := WeightedRoundRobin; m <= Rendezvous; m++ {
+		lb := New(m, nil, nil)
+		var items interface{} = []string{"A"}
+		if _, ok := lb.All().(map[string]int); ok {
+			items = map[string]int{"A": 1}
+		}
+		if err := TryUpdate(lb, items); err != nil {
+			t.Fatalf("%s update wrong: %v", m, err)
+		}
+		if err := TryUpdate(lb, []int{1}); !errors.Is(err, ErrItemsType) {
+			t.Fatalf("%s expected ErrItemsType, actual %v", m, err)
+		}
+	}
+}
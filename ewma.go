@@ -0,0 +1,332 @@
+package balancer
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultDecay is the default decay window of PeakEWMA.
+	DefaultDecay = 10 * time.Second
+
+	// DefaultPenalty is the default response time of PeakEWMA assumed for an item
+	// having in-flight requests but no observation yet.
+	DefaultPenalty = time.Second
+)
+
+// PeakEWMA
+// Keeps a peak-sensitive exponentially weighted moving average of the response time per item,
+// samples two items at random and selects the one with the lower cost = ewma * (inflight+1).
+// Ref: https://linkerd.io/2016/03/16/beyond-round-robin-load-balancing-for-latency/
+type peakEWMA struct {
+	items   []*ewmaItem
+	count   uint32
+	all     map[string]*ewmaItem
+	decay   float64
+	penalty float64
+
+	sync.RWMutex
+}
+
+type ewmaItem struct {
+	item     string
+	inflight int64
+	ewma     float64
+	stamp    int64
+
+	sync.Mutex
+}
+
+func NewPeakEWMA(items ...[]string) (lb *peakEWMA) {
+	lb = &peakEWMA{
+		all:     make(map[string]*ewmaItem),
+		decay:   float64(DefaultDecay),
+		penalty: float64(DefaultPenalty),
+	}
+	if len(items) > 0 && len(items[0]) > 0 {
+		lb.Update(items[0])
+	}
+	return
+}
+
+// SetDecay sets the decay window, the longer the window, the slower the average forgets the peaks.
+func (b *peakEWMA) SetDecay(decay time.Duration) {
+	if decay <= 0 {
+		decay = DefaultDecay
+	}
+	b.Lock()
+	b.decay = float64(decay)
+	b.Unlock()
+}
+
+// SetPenalty sets the response time assumed for an item having in-flight requests but no observation yet,
+// so that a new item hanging is not flooded with the requests.
+func (b *peakEWMA) SetPenalty(penalty time.Duration) {
+	if penalty <= 0 {
+		penalty = DefaultPenalty
+	}
+	b.Lock()
+	b.penalty = float64(penalty)
+	b.Unlock()
+}
+
+// Observe reports the response time of a finished request to the item.
+func (b *peakEWMA) Observe(item string, rtt time.Duration) {
+	b.RLock()
+	c, ok := b.all[item]
+	decay := b.decay
+	b.RUnlock()
+
+	if ok {
+		c.observe(float64(rtt), time.Now().UnixNano(), decay)
+	}
+}
+
+func (b *peakEWMA) Add(item string, _ ...int) {
+	b.Lock()
+	if _, ok := b.all[item]; !ok {
+		c := &ewmaItem{item: item}
+		b.items = append(b.items, c)
+		b.all[item] = c
+		b.count++
+	}
+	b.Unlock()
+}
+
+func (b *peakEWMA) All() interface{} {
+	b.RLock()
+	all := make([]string, b.count)
+	for i, v := range b.items {
+		all[i] = v.item
+	}
+	b.RUnlock()
+
+	return all
+}
+
+func (b *peakEWMA) Name() string {
+	return "PeakEWMA"
+}
+
+func (b *peakEWMA) Select(_ ...string) (item string) {
+	b.RLock()
+	if c := b.chooseNext(nil); c != nil {
+		item = c.item
+	}
+	b.RUnlock()
+
+	return
+}
+
+// Acquire gets next selected item and counts an in-flight request on it,
+// done also reports the time elapsed since Acquire as the response time.
+func (b *peakEWMA) Acquire(key ...string) (string, func()) {
+	return b.AcquireExcept(nil, key...)
+}
+
+// AcquireExcept gets next selected item other than the excluded items and counts an in-flight request on it,
+// done also reports the time elapsed since AcquireExcept as the response time.
+func (b *peakEWMA) AcquireExcept(exclude []string, _ ...string) (string, func()) {
+	b.RLock()
+	c := b.chooseNext(excluded(exclude))
+	if c == nil {
+		b.RUnlock()
+		return "", noop
+	}
+	atomic.AddInt64(&c.inflight, 1)
+	decay := b.decay
+	b.RUnlock()
+
+	start := time.Now()
+	release := releaser(&c.inflight)
+	var observed int32
+	return c.item, func() {
+		if atomic.CompareAndSwapInt32(&observed, 0, 1) {
+			release()
+			c.observe(float64(time.Since(start)), time.Now().UnixNano(), decay)
+		}
+	}
+}
+
+// SelectExcept gets the lower cost one of two items sampled other than the excluded items.
+func (b *peakEWMA) SelectExcept(exclude []string, _ ...string) (item string) {
+	skip := excluded(exclude)
+	if skip == nil {
+		return b.Select()
+	}
+
+	b.RLock()
+	if c := b.chooseNext(skip); c != nil {
+		item = c.item
+	}
+	b.RUnlock()
+
+	return
+}
+
+// SelectN gets up to n distinct items, the selected item and then the rest in the order of cost.
+func (b *peakEWMA) SelectN(n int, _ ...string) []string {
+	b.RLock()
+	defer b.RUnlock()
+
+	p := newPicker(n, int(b.count))
+	if p.full() {
+		return nil
+	}
+	c := b.chooseNext(nil)
+	p.add(c.item)
+
+	type cost struct {
+		item string
+		cost float64
+	}
+	now := time.Now().UnixNano()
+	rest := make([]cost, 0, b.count-1)
+	for _, x := range b.items {
+		if x != c {
+			rest = append(rest, cost{x.item, x.cost(now, b.decay, b.penalty)})
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		return rest[i].cost < rest[j].cost
+	})
+	for _, x := range rest {
+		if p.add(x.item) {
+			break
+		}
+	}
+	return p.result()
+}
+
+// chooseNext samples two items among the ones not skipped.
+func (b *peakEWMA) chooseNext(skip func(string) bool) *ewmaItem {
+	items := b.items
+	if skip != nil {
+		items = make([]*ewmaItem, 0, b.count)
+		for _, c := range b.items {
+			if !skip(c.item) {
+				items = append(items, c)
+			}
+		}
+	}
+	switch len(items) {
+	case 0:
+		return nil
+	case 1:
+		return items[0]
+	}
+
+	i, j := sampleTwo(uint32(len(items)))
+	now := time.Now().UnixNano()
+	x, y := items[i], items[j]
+	if y.cost(now, b.decay, b.penalty) < x.cost(now, b.decay, b.penalty) {
+		return y
+	}
+	return x
+}
+
+func (b *peakEWMA) Remove(item string, _ ...bool) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.all[item]; !ok {
+		return false
+	}
+	for i := uint32(0); i < b.count; i++ {
+		if item == b.items[i].item {
+			b.items = append(b.items[:i], b.items[i+1:]...)
+			b.count--
+			delete(b.all, item)
+			break
+		}
+	}
+	return true
+}
+
+func (b *peakEWMA) RemoveAll() {
+	b.Lock()
+	b.items = b.items[:0]
+	b.count = 0
+	b.all = make(map[string]*ewmaItem)
+	b.Unlock()
+}
+
+// Reset forgets all observed response times.
+func (b *peakEWMA) Reset() {
+	b.RLock()
+	for _, c := range b.items {
+		c.Lock()
+		c.ewma = 0
+		c.stamp = 0
+		c.Unlock()
+	}
+	b.RUnlock()
+}
+
+func (b *peakEWMA) Update(items interface{}) bool {
+	v, ok := items.([]string)
+	if !ok {
+		return false
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	// keep the observations of the retained items
+	data := make([]*ewmaItem, 0, len(v))
+	all := make(map[string]*ewmaItem, len(v))
+	for _, item := range v {
+		if _, ok := all[item]; ok {
+			continue
+		}
+		c, ok := b.all[item]
+		if !ok {
+			c = &ewmaItem{item: item}
+		}
+		data = append(data, c)
+		all[item] = c
+	}
+
+	b.items = data
+	b.count = uint32(len(data))
+	b.all = all
+
+	return true
+}
+
+// observe updates the average, it jumps to a peak immediately and decays over time.
+func (c *ewmaItem) observe(rtt float64, now int64, decay float64) {
+	c.Lock()
+	if rtt > c.ewma {
+		c.ewma = rtt
+	} else {
+		w := math.Exp(-float64(now-c.stamp) / decay)
+		c.ewma = c.ewma*w + rtt*(1-w)
+	}
+	c.stamp = now
+	c.Unlock()
+}
+
+// cost is the decayed average multiplied by the pending requests,
+// an item without any observation costs nothing while idle, otherwise the penalty is taken as the average.
+func (c *ewmaItem) cost(now int64, decay, penalty float64) float64 {
+	inflight := float64(atomic.LoadInt64(&c.inflight))
+
+	c.Lock()
+	ewma, stamp := c.ewma, c.stamp
+	c.Unlock()
+
+	if ewma == 0 {
+		if inflight == 0 {
+			return 0
+		}
+		ewma, stamp = penalty, now
+	}
+	if elapsed := now - stamp; elapsed > 0 {
+		ewma *= math.Exp(-float64(elapsed) / decay)
+	}
+	return ewma * (inflight + 1)
+}
@@ -0,0 +1,242 @@
+package balancer
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPeakEWMA(t *testing.T) {
+	lb := NewPeakEWMA()
+	item := lb.Select()
+	if item != "" {
+		t.Fatalf("ewma expected empty, actual %s", item)
+	}
+	item, done := lb.Acquire()
+	if item != "" {
+		t.Fatalf("ewma expected empty, actual %s", item)
+	}
+	done()
+
+	lb.Add("A")
+	item = lb.Select()
+	if item != "A" {
+		t.Fatalf("ewma expected A, actual %s", item)
+	}
+
+	nodes := []string{"A", "B", "C", "D"}
+	lb = NewPeakEWMA(nodes)
+	count := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		item := lb.Select()
+		count[item]++
+	}
+	if count["A"] <= 300 || count["B"] <= 300 || count["C"] <= 300 || count["D"] <= 300 {
+		t.Fatal("ewma wrong")
+	}
+
+	// the slowest item is never selected
+	lb.Observe("A", 100*time.Millisecond)
+	lb.Observe("B", 10*time.Millisecond)
+	lb.Observe("C", 10*time.Millisecond)
+	lb.Observe("D", 20*time.Millisecond)
+	lb.Observe("X", time.Second)
+	count = make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		item := lb.Select()
+		count[item]++
+	}
+	if count["A"] != 0 || count["B"] <= count["D"] || count["C"] <= count["D"] {
+		t.Fatal("ewma wrong")
+	}
+
+	// peaks are taken immediately
+	lb.Observe("B", 200*time.Millisecond)
+	for i := 0; i < 1000; i++ {
+		item := lb.Select()
+		if item == "B" {
+			t.Fatalf("ewma unexpected %s", item)
+		}
+	}
+
+	// and forgotten slowly
+	lb.Observe("B", time.Millisecond)
+	lb.RLock()
+	ewma := lb.all["B"].ewma
+	lb.RUnlock()
+	if ewma < float64(190*time.Millisecond) {
+		t.Fatalf("ewma decay wrong: %v", time.Duration(ewma))
+	}
+	lb.SetDecay(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	lb.Observe("B", time.Millisecond)
+	lb.RLock()
+	ewma = lb.all["B"].ewma
+	lb.RUnlock()
+	if ewma != float64(time.Millisecond) {
+		t.Fatalf("ewma decay wrong: %v", time.Duration(ewma))
+	}
+	lb.SetDecay(0)
+
+	// the pending requests are taken into account
+	lb.Reset()
+	lb.Observe("A", 10*time.Millisecond)
+	lb.Observe("B", 10*time.Millisecond)
+	lb.Observe("C", 10*time.Millisecond)
+	lb.Observe("D", 10*time.Millisecond)
+	busy, doneBusy := lb.Acquire()
+	for i := 0; i < 1000; i++ {
+		item := lb.Select()
+		if item == busy {
+			t.Fatalf("ewma unexpected %s", item)
+		}
+	}
+	doneBusy()
+	doneBusy()
+	lb.RLock()
+	inflight := atomic.LoadInt64(&lb.all[busy].inflight)
+	lb.RUnlock()
+	if inflight != 0 {
+		t.Fatalf("ewma wrong: %s in-flight %d", busy, inflight)
+	}
+
+	lb.Add("A")
+	lb.Add("E")
+	all := lb.All().([]string)
+	if strings.Join(all, "") != "ABCDE" {
+		t.Fatal("ewma all() wrong")
+	}
+
+	ok := lb.Remove("C")
+	if ok != true {
+		t.Fatal("ewma remove() wrong")
+	}
+	ok = lb.Remove("C")
+	if ok != false {
+		t.Fatal("ewma remove() wrong")
+	}
+	all = lb.All().([]string)
+	if strings.Join(all, "") != "ABDE" {
+		t.Fatal("ewma all() wrong")
+	}
+
+	ok = lb.Update(map[string]int{"X": 1})
+	if ok != false {
+		t.Fatal("ewma update wrong")
+	}
+
+	ok = lb.Update([]string{"X", "A", "X"})
+	if ok != true {
+		t.Fatal("ewma update wrong")
+	}
+	all = lb.All().([]string)
+	if strings.Join(all, "") != "XA" {
+		t.Fatal("ewma update wrong")
+	}
+	lb.RLock()
+	ewma = lb.all["A"].ewma
+	lb.RUnlock()
+	if ewma == 0 {
+		t.Fatal("ewma update wrong")
+	}
+
+	lb.RemoveAll()
+	lb.Add("F", 1)
+	all, ok = lb.All().([]string)
+	if !ok || len(all) != 1 {
+		t.Fatal("ewma all() wrong")
+	}
+}
+
+func TestPeakEWMA_Penalty(t *testing.T) {
+	lb := NewPeakEWMA([]string{"A", "B"})
+	lb.Observe("A", time.Millisecond)
+	lb.Observe("B", time.Millisecond)
+
+	// a new item hanging gets a few requests only
+	lb.Add("C")
+	var dones []func()
+	count := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		item, done := lb.Acquire()
+		count[item]++
+		if item == "C" {
+			dones = append(dones, done)
+			continue
+		}
+		done()
+	}
+	if count["C"] > 3 || count["A"] < 50 || count["B"] < 50 {
+		t.Fatalf("ewma penalty wrong: %v", count)
+	}
+	for _, done := range dones {
+		done()
+	}
+
+	// idle, the new item is tried first
+	lb.Remove("C")
+	lb.Add("D")
+	lb.SetPenalty(0)
+	for i := 0; i < 10; i++ {
+		if item := lb.Select(); item == "D" {
+			return
+		}
+	}
+	t.Fatal("ewma new item wrong")
+}
+
+func TestPeakEWMA_SelectN(t *testing.T) {
+	lb := NewPeakEWMA([]string{"A", "B", "C", "D"})
+	lb.Observe("A", 40*time.Millisecond)
+	lb.Observe("B", 20*time.Millisecond)
+	lb.Observe("C", 30*time.Millisecond)
+	lb.Observe("D", 10*time.Millisecond)
+	for i := 0; i < 100; i++ {
+		items := lb.SelectN(4)
+		if len(items) != 4 || items[0] == "A" || items[3] != "A" {
+			t.Fatalf("ewma select n wrong: %v", items)
+		}
+	}
+}
+
+func TestPeakEWMA_C(t *testing.T) {
+	var (
+		a, b, c, d int64
+	)
+	nodes := []string{"A", "B", "C", "D"}
+	lb := NewPeakEWMA(nodes)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				item, done := lb.Acquire()
+				switch item {
+				case "A":
+					atomic.AddInt64(&a, 1)
+				case "B":
+					atomic.AddInt64(&b, 1)
+				case "C":
+					atomic.AddInt64(&c, 1)
+				case "D":
+					atomic.AddInt64(&d, 1)
+				}
+				done()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt64(&a)+atomic.LoadInt64(&b)+atomic.LoadInt64(&c)+atomic.LoadInt64(&d) != 1000000 {
+		t.Fatal("ewma wrong: sum")
+	}
+	for _, v := range lb.items {
+		if atomic.LoadInt64(&v.inflight) != 0 {
+			t.Fatalf("ewma wrong: %s in-flight %d", v.item, v.inflight)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/fufuok/balancer"
+	"github.com/fufuok/balancer/generic"
+)
+
+type Backend struct {
+	Addr string
+	Zone string
+}
+
+func main() {
+	a := Backend{"10.0.0.1:80", "zone-a"}
+	b := Backend{"10.0.0.2:80", "zone-b"}
+
+	// items are known to the balancer by the key
+	lb := generic.New[Backend](balancer.SmoothWeightedRoundRobin, func(b Backend) string {
+		return b.Addr
+	})
+	lb.UpdateWeights(map[Backend]int{
+		a: 2,
+		b: 1,
+	})
+	fmt.Println("balancer name:", lb.Name())
+
+	// output: zone-a zone-b zone-a
+	for i := 0; i < 3; i++ {
+		backend, _ := lb.Select()
+		fmt.Print(backend.Zone, " ")
+	}
+	fmt.Println()
+
+	// the key is fmt.Sprint by default
+	u1, _ := url.Parse("http://10.0.0.1:8080")
+	u2, _ := url.Parse("http://10.0.0.2:8080")
+	ch := generic.New[*url.URL](balancer.ConsistentHash, nil)
+	ch.Update([]*url.URL{u1, u2})
+	u, ok := ch.Select("192.168.1.100")
+	fmt.Println(u.Host, ok)
+	fmt.Println(len(ch.All()))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fufuok/balancer"
+)
+
+func main() {
+	nodes := []string{"A", "B", "C"}
+	// lb := balancer.New(balancer.LeastConnections, nil, nodes)
+	lb := balancer.NewLeastConnections(nodes)
+	fmt.Println("balancer name:", lb.Name())
+
+	// A B C A B
+	for i := 0; i < 5; i++ {
+		fmt.Print(lb.Select(), " ")
+	}
+	fmt.Println()
+
+	// count an in-flight request on the selected item
+	a, doneA := lb.Acquire()
+	b, doneB := lb.Acquire()
+	// output: C A
+	fmt.Println(a, b)
+
+	// output: B B B
+	for i := 0; i < 3; i++ {
+		fmt.Print(lb.Select(), " ")
+	}
+	fmt.Println()
+
+	// the request is finished
+	doneA()
+	doneB()
+
+	// remove all items
+	lb.RemoveAll()
+}
@@ -0,0 +1,291 @@
+// Package generic selects typed items, e.g. *url.URL or a Backend struct, with the balancers of any mode.
+package generic
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/fufuok/balancer"
+)
+
+// Balancer selects the items of type T, the items are known to the underlying balancer by their keys.
+type Balancer[T comparable] struct {
+	lb    balancer.Balancer
+	key   func(T) string
+	items map[string]T
+
+	mu sync.RWMutex
+}
+
+// New creates a Balancer of the mode, key gets the unique string key of an item, default: fmt.Sprint.
+func New[T comparable](mode balancer.Mode, key func(T) string) *Balancer[T] {
+	return Wrap[T](balancer.New(mode, nil, nil), key)
+}
+
+// Wrap creates a Balancer over the balancer, e.g. a health check or a circuit breaker,
+// key gets the unique string key of an item, default: fmt.Sprint.
+// Items added to the balancer directly are not selected.
+func Wrap[T comparable](lb balancer.Balancer, key func(T) string) *Balancer[T] {
+	if key == nil {
+		key = func(item T) string {
+			return fmt.Sprint(item)
+		}
+	}
+	return &Balancer[T]{
+		lb:    lb,
+		key:   key,
+		items: make(map[string]T),
+	}
+}
+
+// Unwrap gets the underlying balancer, e.g. to report the results of the requests.
+func (b *Balancer[T]) Unwrap() balancer.Balancer {
+	return b.lb
+}
+
+// Key gets the key of the item in the underlying balancer.
+func (b *Balancer[T]) Key(item T) string {
+	return b.key(item)
+}
+
+// Add adds an item to be selected, weight is only used for the weighted modes, default: 1.
+func (b *Balancer[T]) Add(item T, weight ...int) {
+	k := b.key(item)
+
+	b.mu.Lock()
+	b.items[k] = item
+	b.mu.Unlock()
+
+	b.lb.Add(k, weight...)
+}
+
+// SetWeight sets the weight of the item in place, false if the underlying balancer is not a balancer.Weighter.
+func (b *Balancer[T]) SetWeight(item T, weight int) bool {
+	w, ok := b.lb.(balancer.Weighter)
+	if !ok {
+		return false
+	}
+	k := b.key(item)
+
+	b.mu.Lock()
+	b.items[k] = item
+	b.mu.Unlock()
+
+	w.SetWeight(k, weight)
+	return true
+}
+
+// All gets all items.
+func (b *Balancer[T]) All() []T {
+	keys := keysOf(b.lb.All())
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	all := make([]T, 0, len(keys))
+	for _, k := range keys {
+		if item, ok := b.items[k]; ok {
+			all = append(all, item)
+		}
+	}
+	return all
+}
+
+// Weights gets all items and the weights, 1 for the modes not weighted.
+func (b *Balancer[T]) Weights() map[T]int {
+	all := b.lb.All()
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	weights := make(map[T]int)
+	switch v := all.(type) {
+	case []string:
+		for _, k := range v {
+			if item, ok := b.items[k]; ok {
+				weights[item] = 1
+			}
+		}
+	case map[string]int:
+		for k, w := range v {
+			if item, ok := b.items[k]; ok {
+				weights[item] = w
+			}
+		}
+	}
+	return weights
+}
+
+// Name load balancer name.
+func (b *Balancer[T]) Name() string {
+	return b.lb.Name()
+}
+
+// Select gets next selected item, false if there is no item to select.
+// key is only used for ConsistentHash/RingHash/Maglev/Rendezvous.
+func (b *Balancer[T]) Select(key ...string) (T, bool) {
+	return b.itemOf(b.lb.Select(key...))
+}
+
+// Acquire gets next selected item and counts an in-flight request on it,
+// done must be called when the request is finished. See balancer.Acquirer.
+func (b *Balancer[T]) Acquire(key ...string) (T, func(), bool) {
+	a, ok := b.lb.(balancer.Acquirer)
+	if !ok {
+		item, ok := b.Select(key...)
+		return item, func() {}, ok
+	}
+	k, done := a.Acquire(key...)
+	item, ok := b.itemOf(k)
+	return item, done, ok
+}
+
+// SelectN gets up to n distinct items in the order of preference,
+// only the selected item if the underlying balancer is not a balancer.SelectorN.
+func (b *Balancer[T]) SelectN(n int, key ...string) []T {
+	var keys []string
+	if s, ok := b.lb.(balancer.SelectorN); ok {
+		keys = s.SelectN(n, key...)
+	} else if k := b.lb.Select(key...); k != "" && n > 0 {
+		keys = []string{k}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	items := make([]T, 0, len(keys))
+	for _, k := range keys {
+		if item, ok := b.items[k]; ok {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// SelectExcept gets next selected item other than the excluded items,
+// false if the underlying balancer is not a balancer.ExceptSelector and selects an excluded item.
+func (b *Balancer[T]) SelectExcept(exclude []T, key ...string) (T, bool) {
+	keys := make([]string, len(exclude))
+	for i, item := range exclude {
+		keys[i] = b.key(item)
+	}
+	if s, ok := b.lb.(balancer.ExceptSelector); ok {
+		return b.itemOf(s.SelectExcept(keys, key...))
+	}
+	k := b.lb.Select(key...)
+	for _, x := range keys {
+		if k == x {
+			k = ""
+			break
+		}
+	}
+	return b.itemOf(k)
+}
+
+func (b *Balancer[T]) itemOf(k string) (item T, ok bool) {
+	if k == "" {
+		return
+	}
+	b.mu.RLock()
+	item, ok = b.items[k]
+	b.mu.RUnlock()
+	return
+}
+
+// Remove removes an item.
+func (b *Balancer[T]) Remove(item T) bool {
+	k := b.key(item)
+	ok := b.lb.Remove(k, true)
+
+	b.mu.Lock()
+	delete(b.items, k)
+	b.mu.Unlock()
+
+	return ok
+}
+
+// RemoveAll removes all items.
+func (b *Balancer[T]) RemoveAll() {
+	b.lb.RemoveAll()
+
+	b.mu.Lock()
+	b.items = make(map[string]T)
+	b.mu.Unlock()
+}
+
+// Reset resets the balancer.
+func (b *Balancer[T]) Reset() {
+	b.lb.Reset()
+}
+
+// Update reinitializes the items, with the weight 1 for the weighted modes.
+func (b *Balancer[T]) Update(items []T) {
+	data := make(map[string]T, len(items))
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		k := b.key(item)
+		if _, ok := data[k]; !ok {
+			keys = append(keys, k)
+		}
+		data[k] = item
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.lb.Update(keys) {
+		weights := make(map[string]int, len(keys))
+		for _, k := range keys {
+			weights[k] = 1
+		}
+		b.lb.Update(weights)
+	}
+	b.items = data
+}
+
+// UpdateWeights reinitializes the items and the weights,
+// the modes not weighted get the items of a positive weight in the order of the keys.
+func (b *Balancer[T]) UpdateWeights(items map[T]int) {
+	data := make(map[string]T, len(items))
+	weights := make(map[string]int, len(items))
+	for item, w := range items {
+		k := b.key(item)
+		data[k] = item
+		weights[k] = w
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.lb.Update(weights) {
+		keys := make([]string, 0, len(weights))
+		for k, w := range weights {
+			if w > 0 {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		b.lb.Update(keys)
+	}
+	b.items = data
+}
+
+// keysOf gets the keys of All() of the underlying balancer.
+func keysOf(all interface{}) []string {
+	switch v := all.(type) {
+	case []string:
+		return v
+	case map[string]int:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	return nil
+}
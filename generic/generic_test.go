@@ -0,0 +1,202 @@
+package generic
+
+import (
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fufuok/balancer"
+)
+
+type backend struct {
+	Addr string
+	Zone string
+}
+
+func TestBalancer(t *testing.T) {
+	lb := New[backend](balancer.SmoothWeightedRoundRobin, func(b backend) string {
+		return b.Addr
+	})
+	if lb.Name() != "SmoothWeightedRoundRobin" {
+		t.Fatal("generic name wrong")
+	}
+	item, ok := lb.Select()
+	if ok || item != (backend{}) {
+		t.Fatalf("generic expected empty, actual %v", item)
+	}
+
+	a := backend{"10.0.0.1:80", "a"}
+	b := backend{"10.0.0.2:80", "b"}
+	c := backend{"10.0.0.3:80", "a"}
+	lb.UpdateWeights(map[backend]int{
+		a: 5,
+		b: 1,
+		c: 0,
+	})
+	count := make(map[backend]int)
+	for i := 0; i < 600; i++ {
+		item, ok := lb.Select()
+		if !ok {
+			t.Fatal("generic select wrong")
+		}
+		count[item]++
+	}
+	if count[a] != 500 || count[b] != 100 || count[c] != 0 {
+		t.Fatalf("generic select wrong: %v", count)
+	}
+	weights := lb.Weights()
+	if len(weights) != 3 || weights[a] != 5 || weights[c] != 0 {
+		t.Fatalf("generic weights wrong: %v", weights)
+	}
+
+	item, ok = lb.SelectExcept([]backend{a})
+	if !ok || item != b {
+		t.Fatalf("generic expected %v, actual %v", b, item)
+	}
+	items := lb.SelectN(3)
+	if len(items) != 2 {
+		t.Fatalf("generic select n wrong: %v", items)
+	}
+
+	ok = lb.Remove(a)
+	if ok != true || len(lb.All()) != 2 {
+		t.Fatal("generic remove wrong")
+	}
+	ok = lb.Remove(a)
+	if ok != false {
+		t.Fatal("generic remove wrong")
+	}
+
+	// the weight 1 for the weighted modes
+	lb.Update([]backend{a, b, a})
+	all := lb.All()
+	weights = lb.Weights()
+	if len(all) != 2 || weights[a] != 1 || weights[b] != 1 {
+		t.Fatalf("generic update wrong: %v", weights)
+	}
+
+	if !lb.SetWeight(b, 3) || lb.Weights()[b] != 3 {
+		t.Fatal("generic set weight wrong")
+	}
+
+	lb.RemoveAll()
+	lb.Add(c, 2)
+	all = lb.All()
+	if len(all) != 1 || all[0] != c || lb.Weights()[c] != 2 {
+		t.Fatalf("generic add wrong: %v", all)
+	}
+}
+
+func TestBalancer_Modes(t *testing.T) {
+	u1, _ := url.Parse("http://10.0.0.1:8080")
+	u2, _ := url.Parse("http://10.0.0.2:8080")
+	u3, _ := url.Parse("http://10.0.0.3:8080")
+	for m := balancer.WeightedRoundRobin; m <= balancer.Rendezvous; m++ {
+		lb := New[*url.URL](m, nil)
+		lb.UpdateWeights(map[*url.URL]int{
+			u1: 1,
+			u2: 1,
+			u3: 0,
+		})
+		for i := 0; i < 100; i++ {
+			item, ok := lb.Select("192.168.1.100")
+			if !ok || item != u1 && item != u2 {
+				t.Fatalf("%s generic select wrong: %v", m, item)
+			}
+		}
+
+		lb.Update([]*url.URL{u3, u2})
+		all := lb.All()
+		if len(all) != 2 {
+			t.Fatalf("%s generic update wrong: %v", m, all)
+		}
+		item, ok := lb.SelectExcept([]*url.URL{u2}, "192.168.1.100")
+		if !ok || item != u3 {
+			t.Fatalf("%s generic expected %v, actual %v", m, u3, item)
+		}
+	}
+}
+
+func TestBalancer_Acquire(t *testing.T) {
+	lb := New[int](balancer.LeastConnections, nil)
+	lb.Update([]int{1, 2, 3})
+	x, doneX, ok := lb.Acquire()
+	if !ok {
+		t.Fatal("generic acquire wrong")
+	}
+	y, doneY, _ := lb.Acquire()
+	z, doneZ, _ := lb.Acquire()
+	if x == y || y == z || x == z {
+		t.Fatalf("generic acquire wrong: %d %d %d", x, y, z)
+	}
+	doneX()
+	for i := 0; i < 10; i++ {
+		item, _ := lb.Select()
+		if item != x {
+			t.Fatalf("generic expected %d, actual %d", x, item)
+		}
+	}
+	doneY()
+	doneZ()
+
+	// not an Acquirer
+	lb = Wrap[int](balancer.NewRoundRobin(), nil)
+	lb.Add(1)
+	item, done, ok := lb.Acquire()
+	if !ok || item != 1 {
+		t.Fatalf("generic expected 1, actual %d", item)
+	}
+	done()
+	if lb.Key(1) != "1" {
+		t.Fatal("generic key wrong")
+	}
+}
+
+func TestBalancer_Wrap(t *testing.T) {
+	od := balancer.NewOutlierDetection(balancer.NewRoundRobin())
+	od.SetConsecutiveErrors(1)
+	lb := Wrap[backend](od, func(b backend) string {
+		return b.Addr
+	})
+	a := backend{"10.0.0.1:80", "a"}
+	b := backend{"10.0.0.2:80", "b"}
+	lb.Update([]backend{a, b})
+	od.Failure(lb.Key(a))
+	for i := 0; i < 10; i++ {
+		item, _ := lb.Select()
+		if item != b {
+			t.Fatalf("generic expected %v, actual %v", b, item)
+		}
+	}
+	if lb.Unwrap() != balancer.Balancer(od) {
+		t.Fatal("generic unwrap wrong")
+	}
+}
+
+func TestBalancer_C(t *testing.T) {
+	var n int64
+	lb := New[backend](balancer.RoundRobin, nil)
+	lb.Update([]backend{{"A", "a"}, {"B", "b"}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				if _, ok := lb.Select(); ok {
+					atomic.AddInt64(&n, 1)
+				}
+				if i == 0 && j%100 == 0 {
+					lb.Update([]backend{{"B", "b"}, {"A", "a"}})
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if atomic.LoadInt64(&n) != 1000000 {
+		t.Fatalf("generic expected 1000000, actual %d", atomic.LoadInt64(&n))
+	}
+}
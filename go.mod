@@ -1,3 +1,3 @@
 module github.com/fufuok/balancer
 
-go 1.15
+go 1.20
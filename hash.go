@@ -1,49 +1,156 @@
 package balancer
 
 import (
+	"math"
+	"sort"
 	"sync"
+	"sync/atomic"
 
 	"github.com/fufuok/balancer/internal/doublejump"
 	"github.com/fufuok/balancer/utils"
 )
 
 // JumpConsistentHash
+// Weighted items are added to the hash as weight virtual nodes, so that changing a weight only
+// moves the keys of the added or removed virtual nodes.
+// With a load bound, an over capacity item passes the key to the next eligible item.
+// A key passed on from an item goes to the rest by the weighted rendezvous hashing, so that the keys spread evenly.
+// Ref: https://arxiv.org/abs/1608.01350 (Consistent Hashing with Bounded Loads)
 type consistentHash struct {
-	items []string
-	count int
-	h     *doublejump.Hash
+	state atomic.Pointer[chState]
+	total int64
 
-	sync.RWMutex
+	sync.Mutex
 }
 
-func NewConsistentHash(items ...[]string) (lb *consistentHash) {
-	if len(items) > 0 && len(items[0]) > 0 {
-		lb = &consistentHash{}
-		lb.Update(items[0])
-		return
+// chState is a snapshot of the items, never modified once published.
+type chState struct {
+	items    []string
+	count    int
+	all      map[string]int
+	weighted bool
+	h        *doublejump.Hash
+	loads    map[string]*int64
+	bound    float64
+}
+
+// chNode is the virtual node of an item in the hash.
+type chNode struct {
+	item    string
+	replica int
+}
+
+// NewConsistentHash create a ConsistentHash balancer, items: []string or map[string]int.
+func NewConsistentHash(items ...interface{}) (lb *consistentHash) {
+	lb = &consistentHash{}
+	lb.state.Store(&chState{
+		all:   make(map[string]int),
+		h:     doublejump.NewHash(),
+		loads: make(map[string]*int64),
+	})
+	if len(items) > 0 {
+		switch v := items[0].(type) {
+		case []string:
+			if len(v) > 0 {
+				lb.Update(v)
+			}
+		case map[string]int:
+			lb.Update(v)
+		}
 	}
-	return &consistentHash{
-		h: doublejump.NewHash(),
+	return
+}
+
+// clone copies the snapshot to be modified by a writer.
+func (s *chState) clone() *chState {
+	c := *s
+	c.items = append([]string(nil), s.items...)
+	c.all = make(map[string]int, len(s.all))
+	for k, v := range s.all {
+		c.all[k] = v
+	}
+	c.h = s.h.Clone()
+	c.loads = make(map[string]*int64, len(s.loads))
+	for k, v := range s.loads {
+		c.loads[k] = v
 	}
+	return &c
 }
 
-func (b *consistentHash) Add(item string, _ ...int) {
+// modify runs fn on a copy of the snapshot, and publishes the copy.
+func (b *consistentHash) modify(fn func(s *chState)) {
 	b.Lock()
-	b.items = append(b.items, item)
-	b.h.Add(item)
-	b.count++
+	s := b.state.Load().clone()
+	fn(s)
+	b.state.Store(s)
 	b.Unlock()
 }
 
-func (b *consistentHash) All() interface{} {
-	all := make([]string, b.count)
-
-	b.Lock()
-	for i, v := range b.items {
-		all[i] = v
+// SetLoadBound sets the load bound factor c (e.g. 1.25), an item accepts no more than
+// ceil(c * average) in-flight requests counted by Acquire, 0 disables the bound.
+func (b *consistentHash) SetLoadBound(c float64) {
+	if c < 1 {
+		c = 0
 	}
+	b.Lock()
+	s := *b.state.Load()
+	s.bound = c
+	b.state.Store(&s)
 	b.Unlock()
+}
+
+// Add add an item to be selected, weight is only used for the balancer initialized by map[string]int.
+func (b *consistentHash) Add(item string, weight ...int) {
+	b.modify(func(s *chState) {
+		if s.weighted {
+			w := 1
+			if len(weight) > 0 {
+				w = weight[0]
+			}
+			if _, ok := s.all[item]; !ok {
+				s.items = append(s.items, item)
+				s.count++
+			}
+			s.setWeight(item, w)
+		} else {
+			s.items = append(s.items, item)
+			s.count++
+			s.setWeight(item, 1)
+		}
+		if _, ok := s.loads[item]; !ok {
+			s.loads[item] = new(int64)
+		}
+	})
+}
+
+// setWeight adds or removes the virtual nodes of the item.
+func (s *chState) setWeight(item string, weight int) {
+	if weight < 0 {
+		weight = 0
+	}
+	old := s.all[item]
+	for i := old; i < weight; i++ {
+		s.h.Add(chNode{item: item, replica: i})
+	}
+	for i := old - 1; i >= weight; i-- {
+		s.h.Remove(chNode{item: item, replica: i})
+	}
+	s.all[item] = weight
+}
 
+// All get all items, []string or map[string]int, the same type as the items initialized.
+func (b *consistentHash) All() interface{} {
+	s := b.state.Load()
+	if s.weighted {
+		all := make(map[string]int)
+		for k, v := range s.all {
+			all[k] = v
+		}
+		return all
+	}
+
+	all := make([]string, s.count)
+	copy(all, s.items)
 	return all
 }
 
@@ -51,69 +158,280 @@ func (b *consistentHash) Name() string {
 	return "ConsistentHash"
 }
 
-func (b *consistentHash) Select(key ...string) (item string) {
-	b.RLock()
-	switch b.count {
-	case 0:
-		item = ""
-	case 1:
-		item = b.items[0]
-	default:
-		hash := utils.HashString(key...)
-		item, _ = b.h.Get(hash).(string)
+func (b *consistentHash) Select(key ...string) string {
+	return b.chooseNext(b.state.Load(), key)
+}
+
+// Acquire gets next selected item and counts an in-flight request on it.
+func (b *consistentHash) Acquire(key ...string) (string, func()) {
+	return b.AcquireExcept(nil, key...)
+}
+
+// AcquireExcept gets the selected item of the key, or passes the key on to the rest not excluded,
+// and counts an in-flight request on it.
+func (b *consistentHash) AcquireExcept(exclude []string, key ...string) (string, func()) {
+	s := b.state.Load()
+	item := b.selectExcept(s, excluded(exclude), key)
+	load, ok := s.loads[item]
+	if !ok {
+		return item, noop
 	}
-	b.RUnlock()
+	atomic.AddInt64(load, 1)
+	atomic.AddInt64(&b.total, 1)
+
+	return item, releaser(load, &b.total)
+}
 
+func (b *consistentHash) chooseNext(s *chState, key []string) (item string) {
+	switch {
+	case s.h.Len() == 0:
+		return ""
+	case s.count == 1:
+		return s.items[0]
+	}
+
+	hash := utils.HashString(key...)
+	node, _ := s.h.Get(hash).(chNode)
+	item = node.item
+	if s.bound > 0 {
+		item = b.bounded(s, item, key)
+	}
+	return
+}
+
+// next gets the item of the highest rendezvous score for the key among the rest accepted by ok,
+// empty if none is accepted.
+func (s *chState) next(item string, key []string, ok func(string) bool) (best string) {
+	max := math.Inf(-1)
+	for x, w := range s.all {
+		if w <= 0 || x == item || !ok(x) {
+			continue
+		}
+		c := hrwItem{item: x, weight: float64(w)}
+		if score := c.score(key); score > max {
+			max = score
+			best = x
+		}
+	}
 	return
 }
 
+// rest gets the items of positive weights other than the item, in the order of the rendezvous scores for the key.
+func (s *chState) rest(item string, key []string) []string {
+	scores := make([]hrwScore, 0, len(s.all))
+	for x, w := range s.all {
+		if w > 0 && x != item {
+			c := hrwItem{item: x, weight: float64(w)}
+			scores = append(scores, hrwScore{item: x, score: c.score(key)})
+		}
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i].score > scores[j].score
+	})
+	items := make([]string, len(scores))
+	for i, x := range scores {
+		items[i] = x.item
+	}
+	return items
+}
+
+// bounded passes the key from the hashed item over capacity to the next item under capacity,
+// the capacity of an item is in proportion to its weight.
+func (b *consistentHash) bounded(s *chState, item string, key []string) string {
+	n := s.h.Len()
+	if n == 0 {
+		return item
+	}
+	capacity := func(x string) int64 {
+		return int64(math.Ceil(s.bound * float64(atomic.LoadInt64(&b.total)+1) * float64(s.all[x]) / float64(n)))
+	}
+	if s.loadOf(item) < capacity(item) {
+		return item
+	}
+
+	if x := s.next(item, key, func(x string) bool {
+		return s.loadOf(x) < capacity(x)
+	}); x != "" {
+		return x
+	}
+	return item
+}
+
+// SelectExcept gets the selected item of the key, or passes the key on to the rest not excluded.
+// The other keys keep their items, whatever excluded.
+func (b *consistentHash) SelectExcept(exclude []string, key ...string) string {
+	return b.selectExcept(b.state.Load(), excluded(exclude), key)
+}
+
+func (b *consistentHash) selectExcept(s *chState, skip func(string) bool, key []string) string {
+	item := b.chooseNext(s, key)
+	if item == "" || skip == nil || !skip(item) {
+		return item
+	}
+
+	return s.next(item, key, func(x string) bool {
+		return !skip(x)
+	})
+}
+
+// SelectN gets up to n distinct items, the selected item and then the rest in the order the key is passed on.
+func (b *consistentHash) SelectN(n int, key ...string) []string {
+	s := b.state.Load()
+	p := newPicker(n, s.count)
+	if p.full() {
+		return nil
+	}
+	item := b.chooseNext(s, key)
+	if item == "" {
+		return nil
+	}
+	if p.add(item) {
+		return p.result()
+	}
+
+	for _, x := range s.rest(item, key) {
+		if p.add(x) {
+			break
+		}
+	}
+	return p.result()
+}
+
+func (s *chState) loadOf(item string) int64 {
+	if load, ok := s.loads[item]; ok {
+		return atomic.LoadInt64(load)
+	}
+	return 0
+}
+
+func (b *consistentHash) loadOf(item string) int64 {
+	return b.state.Load().loadOf(item)
+}
+
 func (b *consistentHash) Remove(item string, asClean ...bool) (ok bool) {
 	b.Lock()
 	defer b.Unlock()
 
+	if _, found := b.state.Load().all[item]; !found {
+		return false
+	}
+
+	s := b.state.Load().clone()
 	clean := len(asClean) > 0 && asClean[0]
-	for i := 0; i < b.count; i++ {
-		if item == b.items[i] {
-			b.items = append(b.items[:i], b.items[i+1:]...)
-			b.count--
-			b.h.Remove(item)
+	for i := 0; i < s.count; i++ {
+		if item == s.items[i] {
+			s.items = append(s.items[:i], s.items[i+1:]...)
+			s.count--
+			s.setWeight(item, 0)
+			delete(s.all, item)
+			delete(s.loads, item)
 			ok = true
 			// remove all or remove one
 			if !clean {
-				return
+				break
 			}
 			i--
 		}
 	}
+	b.state.Store(s)
 	return
 }
 
 func (b *consistentHash) RemoveAll() {
 	b.Lock()
-	b.items = b.items[:0]
-	b.count = 0
-	b.h = doublejump.NewHash()
+	s := *b.state.Load()
+	s.items = nil
+	s.count = 0
+	s.all = make(map[string]int)
+	s.h = doublejump.NewHash()
+	s.loads = make(map[string]*int64)
+	b.state.Store(&s)
 	b.Unlock()
 }
 
 func (b *consistentHash) Reset() {}
 
+// Update reinitialize the balancer items, []string or map[string]int.
+// Updating the weights of a weighted balancer only moves the keys of the changed virtual nodes.
 func (b *consistentHash) Update(items interface{}) bool {
-	v, ok := items.([]string)
-	if !ok {
+	switch v := items.(type) {
+	case []string:
+		b.update(v)
+	case map[string]int:
+		b.updateWeights(v)
+	default:
 		return false
 	}
+	return true
+}
 
+func (b *consistentHash) update(v []string) {
 	h := doublejump.NewHash()
+	all := make(map[string]int, len(v))
 	for _, x := range v {
-		h.Add(x)
+		h.Add(chNode{item: x})
+		all[x] = 1
 	}
 
 	b.Lock()
-	b.count = len(v)
-	b.items = v
-	b.h = h
+	old := b.state.Load()
+	b.state.Store(&chState{
+		items: append([]string(nil), v...),
+		count: len(v),
+		all:   all,
+		h:     h,
+		loads: old.keepLoads(v),
+		bound: old.bound,
+	})
 	b.Unlock()
+}
 
-	return true
+func (b *consistentHash) updateWeights(v map[string]int) {
+	b.modify(func(s *chState) {
+		if !s.weighted {
+			s.items = nil
+			s.count = 0
+			s.all = make(map[string]int)
+			s.weighted = true
+			s.h = doublejump.NewHash()
+		}
+
+		// the hash depends on the order of adding, keep it independent of the map iteration
+		var items, added []string
+		for _, item := range s.items {
+			if _, ok := v[item]; ok {
+				items = append(items, item)
+			} else {
+				s.setWeight(item, 0)
+				delete(s.all, item)
+			}
+		}
+		for item := range v {
+			if _, ok := s.all[item]; !ok {
+				added = append(added, item)
+			}
+		}
+		sort.Strings(added)
+		items = append(items, added...)
+		for _, item := range items {
+			s.setWeight(item, v[item])
+		}
+
+		s.items = items
+		s.count = len(items)
+		s.loads = s.keepLoads(items)
+	})
+}
+
+// keepLoads keeps the in-flight counters of the retained items.
+func (s *chState) keepLoads(items []string) map[string]*int64 {
+	loads := make(map[string]*int64, len(items))
+	for _, x := range items {
+		if load, ok := s.loads[x]; ok {
+			loads[x] = load
+		} else {
+			loads[x] = new(int64)
+		}
+	}
+	return loads
 }
@@ -1,6 +1,7 @@
 package balancer
 
 import (
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -108,6 +109,270 @@ func TestConsistentHash(t *testing.T) {
 	}
 }
 
+func TestConsistentHash_Weighted(t *testing.T) {
+	lb := NewConsistentHash(map[string]int{})
+	item := lb.Select()
+	if item != "" {
+		t.Fatalf("hash expected empty, actual %s", item)
+	}
+
+	lb.Add("A", 0)
+	item = lb.Select()
+	if item != "" {
+		t.Fatalf("hash expected empty, actual %s", item)
+	}
+	lb.Add("B", 1)
+	item = lb.Select("192.168.1.100")
+	if item != "B" {
+		t.Fatalf("hash expected B, actual %s", item)
+	}
+
+	nodes := map[string]int{
+		"A": 0,
+		"B": 10,
+		"C": 70,
+		"D": 20,
+	}
+	lb = New(ConsistentHash, nodes, nil).(*consistentHash)
+	count := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		item := lb.Select(strconv.Itoa(i))
+		count[item]++
+	}
+	if count["A"] != 0 || count["B"] <= 800 || count["C"] <= 6500 || count["D"] <= 1700 {
+		t.Fatalf("hash weighted wrong: %v", count)
+	}
+
+	// the same items and weights, the same selection
+	other := NewConsistentHash(map[string]int{
+		"D": 20,
+		"C": 70,
+		"B": 10,
+		"A": 0,
+	})
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		if lb.Select(key) != other.Select(key) {
+			t.Fatal("hash weighted wrong")
+		}
+	}
+
+	// increasing a weight only moves keys to the item
+	before := make(map[string]string)
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(i)
+		before[key] = lb.Select(key)
+	}
+	lb.Add("B", 20)
+	moved := 0
+	for key, v := range before {
+		item := lb.Select(key)
+		if item != v {
+			moved++
+			if item != "B" {
+				t.Fatalf("hash %s expected B, actual %s", key, item)
+			}
+		}
+	}
+	if moved < 500 || moved > 1500 {
+		t.Fatalf("hash weighted moved: %d", moved)
+	}
+
+	// decreasing a weight only moves keys from the item
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(i)
+		before[key] = lb.Select(key)
+	}
+	ok := lb.Update(map[string]int{
+		"B": 20,
+		"C": 50,
+		"D": 20,
+	})
+	if ok != true {
+		t.Fatal("hash update wrong")
+	}
+	for key, v := range before {
+		item := lb.Select(key)
+		if item != v && v != "C" {
+			t.Fatalf("hash %s expected %s, actual %s", key, v, item)
+		}
+	}
+
+	all, ok := lb.All().(map[string]int)
+	if !ok || len(all) != 3 || all["C"] != 50 {
+		t.Fatal("hash all() wrong")
+	}
+
+	ok = lb.Remove("C")
+	if ok != true {
+		t.Fatal("hash remove() wrong")
+	}
+	all, ok = lb.All().(map[string]int)
+	if !ok || len(all) != 2 || all["B"] != 20 {
+		t.Fatal("hash all() wrong")
+	}
+
+	// back to the unweighted items
+	ok = lb.Update([]string{"X", "Y"})
+	if ok != true {
+		t.Fatal("hash update wrong")
+	}
+	if _, ok = lb.All().([]string); !ok {
+		t.Fatal("hash all() wrong")
+	}
+	item = lb.Select()
+	if item != "Y" {
+		t.Fatalf("hash expected Y, actual %s", item)
+	}
+
+	ok = lb.Update(1)
+	if ok != false {
+		t.Fatal("hash update wrong")
+	}
+}
+
+func TestConsistentHash_SelectN(t *testing.T) {
+	lb := NewConsistentHash([]string{"A", "B", "C", "D"})
+	items := lb.SelectN(3, "192.168.1.101")
+	if strings.Join(items, "") != "CBA" {
+		t.Fatalf("hash expected CBA, actual %v", items)
+	}
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		items := lb.SelectN(2, key)
+		if len(items) != 2 || items[0] != lb.Select(key) {
+			t.Fatalf("hash select n wrong: %v", items)
+		}
+	}
+
+	// the same as the items passed over by the load bound
+	lb.SetLoadBound(1.25)
+	_, done := lb.Acquire("192.168.1.101")
+	item := lb.Select("192.168.1.101")
+	if item != "B" {
+		t.Fatalf("hash expected B, actual %s", item)
+	}
+	done()
+}
+
+func TestConsistentHash_SelectExcept(t *testing.T) {
+	lb := NewConsistentHash([]string{"A", "B", "C", "D"})
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		item := lb.Select(key)
+		// the key only moves when its item is excluded
+		other := "A"
+		if item == "A" {
+			other = "B"
+		}
+		if lb.SelectExcept([]string{other}, key) != item {
+			t.Fatalf("ch select except wrong: %s", key)
+		}
+		next := lb.SelectExcept([]string{item}, key)
+		if next == "" || next == item || next != lb.SelectN(2, key)[1] {
+			t.Fatalf("ch select except wrong: %s", next)
+		}
+	}
+}
+
+func TestConsistentHash_SelectExcept_Spread(t *testing.T) {
+	lb := NewConsistentHash([]string{"a", "b", "c", "d", "e", "f"})
+	exclude := []string{"a", "b", "c"}
+
+	// the keys of the excluded items spread over the rest evenly
+	count := make(map[string]int)
+	for i := 0; i < 60000; i++ {
+		count[lb.SelectExcept(exclude, strconv.Itoa(i))]++
+	}
+	if len(count) != 3 {
+		t.Fatalf("ch select except wrong: %v", count)
+	}
+	for _, x := range []string{"d", "e", "f"} {
+		if count[x] < 18000 || count[x] > 22000 {
+			t.Fatalf("ch select except wrong: %v", count)
+		}
+	}
+
+	// in proportion to the weights
+	lb = NewConsistentHash(map[string]int{"a": 1, "b": 1, "c": 2})
+	count = make(map[string]int)
+	for i := 0; i < 40000; i++ {
+		count[lb.SelectExcept([]string{"a"}, strconv.Itoa(i))]++
+	}
+	if count["b"] < 12000 || count["b"] > 14700 || count["c"] < 25300 {
+		t.Fatalf("ch select except wrong: %v", count)
+	}
+}
+
+func TestConsistentHash_LoadBound(t *testing.T) {
+	nodes := []string{"A", "B", "C", "D"}
+	lb := NewConsistentHash(nodes)
+
+	// without a load bound, the key always goes to the same item
+	var dones []func()
+	for i := 0; i < 100; i++ {
+		item, done := lb.Acquire("192.168.1.100")
+		if item != "A" {
+			t.Fatalf("hash expected A, actual %s", item)
+		}
+		dones = append(dones, done)
+	}
+	for _, done := range dones {
+		done()
+		done()
+	}
+	if lb.loadOf("A") != 0 || atomic.LoadInt64(&lb.total) != 0 {
+		t.Fatal("hash acquire wrong")
+	}
+
+	// hot keys spill over to the next items
+	lb.SetLoadBound(1.25)
+	count := make(map[string]int)
+	dones = dones[:0]
+	for i := 0; i < 100; i++ {
+		item, done := lb.Acquire("192.168.1.100")
+		count[item]++
+		dones = append(dones, done)
+	}
+	if count["A"] != 32 || count["B"]+count["C"]+count["D"] != 68 {
+		t.Fatalf("hash load bound wrong: %v", count)
+	}
+	for _, v := range nodes {
+		if lb.loadOf(v) > 32 {
+			t.Fatalf("hash load bound wrong: %v", count)
+		}
+	}
+
+	// released items take the keys back
+	for _, done := range dones {
+		done()
+	}
+	item := lb.Select("192.168.1.100")
+	if item != "A" {
+		t.Fatalf("hash expected A, actual %s", item)
+	}
+
+	_, done := lb.Acquire("192.168.1.100")
+	lb.Remove("A")
+	done()
+	item, done = lb.Acquire("192.168.1.100")
+	if item == "A" || item == "" {
+		t.Fatalf("hash unexpected %s", item)
+	}
+	done()
+
+	lb.SetLoadBound(0)
+	lb.Update([]string{"X"})
+	item, done = lb.Acquire("192.168.1.100")
+	if item != "X" {
+		t.Fatalf("hash expected X, actual %s", item)
+	}
+	done()
+	if lb.loadOf("X") != 0 || atomic.LoadInt64(&lb.total) != 0 {
+		t.Fatal("hash acquire wrong")
+	}
+}
+
 func TestConsistentHash_C(t *testing.T) {
 	var c int64
 	nodes := []string{"A", "B", "C", "D"}
@@ -0,0 +1,349 @@
+package balancer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHealthInterval is the default interval of the health checks.
+	DefaultHealthInterval = 5 * time.Second
+
+	// DefaultHealthTimeout is the default timeout of a probe.
+	DefaultHealthTimeout = 2 * time.Second
+
+	// DefaultRise is the default number of consecutive successful probes to mark an item healthy.
+	DefaultRise = 2
+
+	// DefaultFall is the default number of consecutive failed probes to mark an item unhealthy.
+	DefaultFall = 3
+)
+
+// HealthStatus is the health of the items of a balancer.
+type HealthStatus struct {
+	// Total the number of items
+	Total int
+	// Unhealthy the unhealthy or ejected items
+	Unhealthy []string
+	// Panic too few healthy items, the health is ignored by the selections
+	Panic bool
+}
+
+// panicking reports whether the healthy items are less than the threshold percent of the total.
+func panicking(threshold float64, total, unhealthy int) bool {
+	return threshold > 0 && total > 0 && float64(total-unhealthy) < threshold*float64(total)
+}
+
+// Probe checks an item, nil means healthy.
+type Probe func(ctx context.Context, item string) error
+
+// TCPProbe connects to the item, e.g. "192.168.1.1:80".
+func TCPProbe() Probe {
+	var d net.Dialer
+	return func(ctx context.Context, item string) error {
+		conn, err := d.DialContext(ctx, "tcp", item)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// HTTPProbe sends a GET request to the item + path, e.g. "http://192.168.1.1:80" + "/health",
+// http:// is prepended to the item without a scheme.
+// The response status must be one of the expected status, default: 2xx.
+func HTTPProbe(path string, status ...int) Probe {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return func(ctx context.Context, item string) error {
+		url := item + path
+		if !strings.Contains(item, "://") {
+			url = "http://" + url
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		_ = resp.Body.Close()
+
+		if len(status) == 0 {
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return nil
+			}
+		}
+		for _, code := range status {
+			if resp.StatusCode == code {
+				return nil
+			}
+		}
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+}
+
+// HealthCheck
+// Wraps a balancer, probes each item of it periodically and marks the items healthy or unhealthy
+// after rise/fall consecutive results. Unhealthy items are passed over by SelectExcept of the balancer,
+// the items and weights themselves are untouched, so they keep working with Add/Remove/Update.
+type healthCheck struct {
+	Balancer
+
+	probe    Probe
+	interval time.Duration
+	timeout  time.Duration
+	rise     int
+	fall     int
+	panic    float64
+
+	states    map[string]*healthState
+	unhealthy []string
+	total     int
+	stop      chan struct{}
+
+	sync.RWMutex
+}
+
+type healthState struct {
+	healthy bool
+	count   int
+	err     error
+}
+
+// NewHealthCheck wraps the balancer with the health checks of the probe, default: TCPProbe.
+// Items are healthy until the probe fails fall times in a row. Start to run the checks.
+func NewHealthCheck(lb Balancer, probe Probe) *healthCheck {
+	if probe == nil {
+		probe = TCPProbe()
+	}
+	return &healthCheck{
+		Balancer: lb,
+		probe:    probe,
+		interval: DefaultHealthInterval,
+		timeout:  DefaultHealthTimeout,
+		rise:     DefaultRise,
+		fall:     DefaultFall,
+		states:   make(map[string]*healthState),
+	}
+}
+
+// SetInterval sets the interval of the health checks and the timeout of a probe.
+func (b *healthCheck) SetInterval(interval, timeout time.Duration) {
+	if interval <= 0 {
+		interval = DefaultHealthInterval
+	}
+	if timeout <= 0 || timeout > interval {
+		timeout = interval
+	}
+	b.Lock()
+	b.interval = interval
+	b.timeout = timeout
+	b.Unlock()
+}
+
+// SetThreshold sets the number of consecutive probes to mark an item healthy (rise) or unhealthy (fall).
+func (b *healthCheck) SetThreshold(rise, fall int) {
+	if rise < 1 {
+		rise = DefaultRise
+	}
+	if fall < 1 {
+		fall = DefaultFall
+	}
+	b.Lock()
+	b.rise = rise
+	b.fall = fall
+	b.Unlock()
+}
+
+// SetPanicThreshold sets the min percent (0, 1] of the healthy items, e.g. 0.5, 0 disables it (default).
+// Below the threshold, the balancer selects across all the items, instead of overloading the few healthy ones.
+func (b *healthCheck) SetPanicThreshold(threshold float64) {
+	if threshold < 0 || threshold > 1 {
+		threshold = 0
+	}
+	b.Lock()
+	b.panic = threshold
+	b.Unlock()
+}
+
+// Status gets the health of the items as of the last check.
+func (b *healthCheck) Status() HealthStatus {
+	b.RLock()
+	defer b.RUnlock()
+
+	return HealthStatus{
+		Total:     b.total,
+		Unhealthy: append([]string(nil), b.unhealthy...),
+		Panic:     panicking(b.panic, b.total, len(b.unhealthy)),
+	}
+}
+
+// Start runs the health checks every interval in the background, until Stop.
+func (b *healthCheck) Start() {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	b.stop = stop
+
+	go func() {
+		for {
+			b.Check()
+
+			b.RLock()
+			interval := b.interval
+			b.RUnlock()
+
+			select {
+			case <-stop:
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// Stop stops the health checks, the items keep their current health.
+func (b *healthCheck) Stop() {
+	b.Lock()
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+	b.Unlock()
+}
+
+// Check probes all the items of the balancer concurrently, and waits for the results.
+func (b *healthCheck) Check() {
+	items := itemsOf(b.Balancer.All())
+
+	b.RLock()
+	timeout := b.timeout
+	b.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	errs := make([]error, len(items))
+	var wg sync.WaitGroup
+	for i := range items {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = b.probe(ctx, items[i])
+		}(i)
+	}
+	wg.Wait()
+
+	b.Lock()
+	defer b.Unlock()
+
+	states := make(map[string]*healthState, len(items))
+	for i, item := range items {
+		s, ok := b.states[item]
+		if !ok {
+			s = &healthState{healthy: true}
+		}
+		s.update(errs[i], b.rise, b.fall)
+		states[item] = s
+	}
+	// never modified in place, shared with the selections
+	var unhealthy []string
+	for item, s := range states {
+		if !s.healthy {
+			unhealthy = append(unhealthy, item)
+		}
+	}
+	b.states = states
+	b.unhealthy = unhealthy
+	b.total = len(items)
+}
+
+// update counts the consecutive results against the current health.
+func (s *healthState) update(err error, rise, fall int) {
+	s.err = err
+	if (err == nil) == s.healthy {
+		s.count = 0
+		return
+	}
+	s.count++
+	if s.healthy && s.count >= fall || !s.healthy && s.count >= rise {
+		s.healthy = !s.healthy
+		s.count = 0
+	}
+}
+
+// Healthy reports whether the item is healthy, and the last error of the probe.
+// An item not checked yet is healthy.
+func (b *healthCheck) Healthy(item string) (bool, error) {
+	b.RLock()
+	defer b.RUnlock()
+
+	if s, ok := b.states[item]; ok {
+		return s.healthy, s.err
+	}
+	return true, nil
+}
+
+// Unhealthy gets the unhealthy items.
+func (b *healthCheck) Unhealthy() []string {
+	b.RLock()
+	defer b.RUnlock()
+
+	return append([]string(nil), b.unhealthy...)
+}
+
+// unhealthyItems gets the items to skip, none in the panic mode.
+func (b *healthCheck) unhealthyItems() []string {
+	b.RLock()
+	defer b.RUnlock()
+
+	if panicking(b.panic, b.total, len(b.unhealthy)) {
+		return nil
+	}
+	return b.unhealthy
+}
+
+// Select gets next selected item other than the unhealthy items.
+func (b *healthCheck) Select(key ...string) string {
+	unhealthy := b.unhealthyItems()
+	if len(unhealthy) == 0 {
+		return b.Balancer.Select(key...)
+	}
+	return selectExcept(b.Balancer, unhealthy, key...)
+}
+
+// SelectN gets up to n distinct items other than the unhealthy items.
+func (b *healthCheck) SelectN(n int, key ...string) []string {
+	return selectNExcept(b.Balancer, n, b.unhealthyItems(), key...)
+}
+
+// SelectExcept gets next selected item other than the excluded and the unhealthy items.
+func (b *healthCheck) SelectExcept(exclude []string, key ...string) string {
+	return selectExcept(b.Balancer, append(exclude[:len(exclude):len(exclude)], b.unhealthyItems()...), key...)
+}
+
+// Acquire gets next selected item other than the unhealthy items and counts an in-flight request on it,
+// done is a no-op if the balancer does not count the in-flight requests.
+func (b *healthCheck) Acquire(key ...string) (string, func()) {
+	return acquireExcept(b.Balancer, b.unhealthyItems(), key...)
+}
+
+// AcquireExcept gets next selected item other than the excluded and the unhealthy items
+// and counts an in-flight request on it.
+func (b *healthCheck) AcquireExcept(exclude []string, key ...string) (string, func()) {
+	return acquireExcept(b.Balancer, append(exclude[:len(exclude):len(exclude)], b.unhealthyItems()...), key...)
+}
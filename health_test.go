@@ -0,0 +1,215 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck(t *testing.T) {
+	var status int64 = http.StatusOK
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(int(atomic.LoadInt64(&status)))
+	})
+	a := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer a.Close()
+	b := httptest.NewServer(handler)
+	defer b.Close()
+
+	nodes := map[string]int{
+		a.URL: 1,
+		b.URL: 2,
+	}
+	lb := NewHealthCheck(NewSmoothWeightedRoundRobin(nodes), HTTPProbe("/health"))
+	if lb.Name() != "SmoothWeightedRoundRobin" {
+		t.Fatal("health name wrong")
+	}
+	lb.SetThreshold(2, 2)
+
+	lb.Check()
+	if len(lb.Unhealthy()) != 0 {
+		t.Fatalf("health wrong: %v", lb.Unhealthy())
+	}
+
+	// fall
+	atomic.StoreInt64(&status, http.StatusServiceUnavailable)
+	lb.Check()
+	if len(lb.Unhealthy()) != 0 {
+		t.Fatalf("health fall wrong: %v", lb.Unhealthy())
+	}
+	lb.Check()
+	unhealthy := lb.Unhealthy()
+	if len(unhealthy) != 1 || unhealthy[0] != b.URL {
+		t.Fatalf("health fall wrong: %v", unhealthy)
+	}
+	ok, err := lb.Healthy(b.URL)
+	if ok || err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("health wrong: %v %v", ok, err)
+	}
+	for i := 0; i < 100; i++ {
+		item := lb.Select()
+		if item != a.URL {
+			t.Fatalf("health expected %s, actual %s", a.URL, item)
+		}
+	}
+	items := lb.SelectN(2)
+	if len(items) != 1 || items[0] != a.URL {
+		t.Fatalf("health select n wrong: %v", items)
+	}
+	item := lb.SelectExcept([]string{a.URL})
+	if item != "" {
+		t.Fatalf("health expected empty, actual %s", item)
+	}
+
+	// the weight is kept
+	all := lb.All().(map[string]int)
+	if len(all) != 2 || all[b.URL] != 2 {
+		t.Fatalf("health all() wrong: %v", all)
+	}
+
+	// rise
+	atomic.StoreInt64(&status, http.StatusNoContent)
+	lb.Check()
+	if len(lb.Unhealthy()) != 1 {
+		t.Fatalf("health rise wrong: %v", lb.Unhealthy())
+	}
+	lb.Check()
+	if len(lb.Unhealthy()) != 0 {
+		t.Fatalf("health rise wrong: %v", lb.Unhealthy())
+	}
+	count := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		count[lb.Select()]++
+	}
+	if count[a.URL] != 10 || count[b.URL] != 20 {
+		t.Fatalf("health rise wrong: %v", count)
+	}
+
+	// expected status
+	lb = NewHealthCheck(NewRoundRobin([]string{a.URL, b.URL}), HTTPProbe("/", http.StatusNotFound))
+	lb.SetThreshold(1, 1)
+	lb.Check()
+	unhealthy = lb.Unhealthy()
+	if len(unhealthy) != 1 || unhealthy[0] != a.URL {
+		t.Fatalf("health expected status wrong: %v", unhealthy)
+	}
+
+	// items updated
+	lb.Update([]string{a.URL})
+	lb.Check()
+	if len(lb.Unhealthy()) != 1 {
+		t.Fatalf("health update wrong: %v", lb.Unhealthy())
+	}
+	lb.Update([]string{b.URL})
+	lb.Check()
+	if len(lb.Unhealthy()) != 0 {
+		t.Fatalf("health update wrong: %v", lb.Unhealthy())
+	}
+}
+
+func TestHealthCheck_TCPProbe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := ln.Addr().String()
+	ln2, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := ln2.Addr().String()
+	_ = ln2.Close()
+	defer ln.Close()
+
+	lb := NewHealthCheck(NewRoundRobin([]string{up, down}), nil)
+	lb.SetThreshold(1, 1)
+	lb.SetInterval(time.Second, 500*time.Millisecond)
+	lb.Check()
+	unhealthy := lb.Unhealthy()
+	if len(unhealthy) != 1 || unhealthy[0] != down {
+		t.Fatalf("health tcp probe wrong: %v", unhealthy)
+	}
+}
+
+func TestHealthCheck_Start(t *testing.T) {
+	var down int64
+	probe := func(ctx context.Context, item string) error {
+		if item == "B" && atomic.LoadInt64(&down) == 1 {
+			return errors.New("down")
+		}
+		return nil
+	}
+	lb := NewHealthCheck(NewRoundRobin([]string{"A", "B", "C"}), probe)
+	lb.SetInterval(10*time.Millisecond, 0)
+	lb.Start()
+	lb.Start()
+	defer lb.Stop()
+
+	atomic.StoreInt64(&down, 1)
+	time.Sleep(100 * time.Millisecond)
+	unhealthy := lb.Unhealthy()
+	if len(unhealthy) != 1 || unhealthy[0] != "B" {
+		t.Fatalf("health start wrong: %v", unhealthy)
+	}
+
+	atomic.StoreInt64(&down, 0)
+	time.Sleep(100 * time.Millisecond)
+	if len(lb.Unhealthy()) != 0 {
+		t.Fatalf("health start wrong: %v", lb.Unhealthy())
+	}
+
+	lb.Stop()
+	atomic.StoreInt64(&down, 1)
+	time.Sleep(100 * time.Millisecond)
+	if len(lb.Unhealthy()) != 0 {
+		t.Fatalf("health stop wrong: %v", lb.Unhealthy())
+	}
+}
+
+func TestHealthCheck_C(t *testing.T) {
+	probe := func(ctx context.Context, item string) error {
+		if item == "B" {
+			return errors.New("down")
+		}
+		return nil
+	}
+	lb := NewHealthCheck(NewWeightedRoundRobin(map[string]int{
+		"A": 1,
+		"B": 2,
+		"C": 3,
+	}), probe)
+	lb.SetInterval(time.Millisecond, 0)
+	lb.SetThreshold(1, 1)
+	lb.Check()
+	lb.Start()
+	defer lb.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				if item := lb.Select(); item == "B" {
+					t.Errorf("health unexpected %s", item)
+					return
+				}
+				if i == 0 && j%100 == 0 {
+					lb.Update(map[string]int{"A": 1, "B": 2, "C": j%3 + 1})
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -186,3 +186,20 @@ func (h *Hash) Random() interface{} {
 	}
 	return nil
 }
+
+// Clone returns a copy of the hash, modifying the copy does not affect the original one.
+func (h *Hash) Clone() *Hash {
+	c := &Hash{}
+	c.loose.a = append([]interface{}(nil), h.loose.a...)
+	c.loose.f = append([]int(nil), h.loose.f...)
+	c.loose.m = make(map[interface{}]int, len(h.loose.m))
+	for k, v := range h.loose.m {
+		c.loose.m[k] = v
+	}
+	c.compact.a = append([]interface{}(nil), h.compact.a...)
+	c.compact.m = make(map[interface{}]int, len(h.compact.m))
+	for k, v := range h.compact.m {
+		c.compact.m[k] = v
+	}
+	return c
+}
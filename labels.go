@@ -0,0 +1,178 @@
+package balancer
+
+import (
+	"sync"
+)
+
+// Labels is the key/value metadata of an item, e.g. zone, version, canary.
+type Labels map[string]string
+
+// Match reports whether the labels have all the key/values of the selector.
+func (l Labels) Match(selector Labels) bool {
+	for k, v := range selector {
+		if x, ok := l[k]; !ok || x != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Labeled
+// Wraps a balancer, the items carry the labels, and are selected among the ones matching a label selector or a predicate.
+// The items not matching are passed over by SelectExcept of the balancer, so that the algorithm stays fair among the rest.
+type labeled struct {
+	Balancer
+
+	labels map[string]Labels
+
+	sync.RWMutex
+}
+
+// NewLabeled wraps the balancer with the labels of the items.
+func NewLabeled(lb Balancer) *labeled {
+	return &labeled{
+		Balancer: lb,
+		labels:   make(map[string]Labels),
+	}
+}
+
+// AddLabeled adds an item with the labels, weight is only used for the weighted modes.
+func (b *labeled) AddLabeled(item string, labels Labels, weight ...int) {
+	b.SetLabels(item, labels)
+	b.Balancer.Add(item, weight...)
+}
+
+// SetLabels sets the labels of the item, nil removes them.
+func (b *labeled) SetLabels(item string, labels Labels) {
+	b.Lock()
+	defer b.Unlock()
+
+	if len(labels) == 0 {
+		delete(b.labels, item)
+		return
+	}
+	l := make(Labels, len(labels))
+	for k, v := range labels {
+		l[k] = v
+	}
+	b.labels[item] = l
+}
+
+// Labels gets the labels of the item.
+func (b *labeled) Labels(item string) Labels {
+	b.RLock()
+	defer b.RUnlock()
+
+	l := make(Labels, len(b.labels[item]))
+	for k, v := range b.labels[item] {
+		l[k] = v
+	}
+	return l
+}
+
+// SelectMatch gets next selected item among the items having all the labels of the selector.
+func (b *labeled) SelectMatch(selector Labels, key ...string) string {
+	return b.SelectFunc(func(_ string, labels Labels) bool {
+		return labels.Match(selector)
+	}, key...)
+}
+
+// SelectFunc gets next selected item among the items matching the predicate.
+// The labels passed to match must not be modified.
+func (b *labeled) SelectFunc(match func(item string, labels Labels) bool, key ...string) string {
+	unmatched := b.unmatched(match)
+	for {
+		item := selectExcept(b.Balancer, unmatched, key...)
+		// the items may be updated after unmatched
+		if item == "" || b.matches(match, item) {
+			return item
+		}
+		unmatched = append(unmatched, item)
+	}
+}
+
+// SelectExcept gets next selected item other than the excluded items.
+func (b *labeled) SelectExcept(exclude []string, key ...string) string {
+	return selectExcept(b.Balancer, exclude, key...)
+}
+
+// SelectN gets up to n distinct items in the order of preference.
+func (b *labeled) SelectN(n int, key ...string) []string {
+	return selectN(b.Balancer, n, key...)
+}
+
+// SelectNMatch gets up to n distinct items among the items having all the labels of the selector.
+func (b *labeled) SelectNMatch(n int, selector Labels, key ...string) []string {
+	match := func(_ string, labels Labels) bool {
+		return labels.Match(selector)
+	}
+	items := selectNExcept(b.Balancer, n, b.unmatched(match), key...)
+
+	// the items may be updated after unmatched
+	matched := items[:0]
+	for _, item := range items {
+		if b.matches(match, item) {
+			matched = append(matched, item)
+		}
+	}
+	return matched
+}
+
+// matches reports whether the item matches.
+func (b *labeled) matches(match func(item string, labels Labels) bool, item string) bool {
+	b.RLock()
+	defer b.RUnlock()
+
+	return match(item, b.labels[item])
+}
+
+// unmatched gets the items not matching.
+func (b *labeled) unmatched(match func(item string, labels Labels) bool) (items []string) {
+	all := itemsOf(b.Balancer.All())
+
+	b.RLock()
+	defer b.RUnlock()
+
+	for _, item := range all {
+		if !match(item, b.labels[item]) {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+func (b *labeled) Remove(item string, asClean ...bool) bool {
+	ok := b.Balancer.Remove(item, asClean...)
+	b.prune()
+
+	return ok
+}
+
+func (b *labeled) RemoveAll() {
+	b.Balancer.RemoveAll()
+
+	b.Lock()
+	b.labels = make(map[string]Labels)
+	b.Unlock()
+}
+
+// Update reinitializes the items, the retained items keep the labels.
+func (b *labeled) Update(items interface{}) bool {
+	ok := b.Balancer.Update(items)
+	b.prune()
+
+	return ok
+}
+
+// prune removes the labels of the items removed.
+func (b *labeled) prune() {
+	all := weightsOf(b.Balancer.All())
+
+	b.Lock()
+	for item := range b.labels {
+		if _, ok := all[item]; !ok {
+			delete(b.labels, item)
+		}
+	}
+	b.Unlock()
+}
@@ -0,0 +1,124 @@
+package balancer
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestLabeled(t *testing.T) {
+	lb := NewLabeled(NewSmoothWeightedRoundRobin())
+	lb.AddLabeled("A", Labels{"zone": "a", "version": "1"}, 2)
+	lb.AddLabeled("B", Labels{"zone": "a", "version": "2"}, 1)
+	lb.AddLabeled("C", Labels{"zone": "b", "version": "1"}, 1)
+	lb.Add("D", 1)
+
+	// smooth among the matching items
+	var seq string
+	for i := 0; i < 6; i++ {
+		seq += lb.SelectMatch(Labels{"zone": "a"})
+	}
+	if seq != "ABAABA" {
+		t.Fatalf("labeled select match wrong: %s", seq)
+	}
+	for i := 0; i < 10; i++ {
+		item := lb.SelectMatch(Labels{"version": "1", "zone": "b"})
+		if item != "C" {
+			t.Fatalf("labeled expected C, actual %s", item)
+		}
+	}
+	if item := lb.SelectMatch(Labels{"zone": "c"}); item != "" {
+		t.Fatalf("labeled expected empty, actual %s", item)
+	}
+	if item := lb.SelectMatch(nil); item == "" {
+		t.Fatal("labeled select match wrong")
+	}
+
+	count := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		count[lb.SelectFunc(func(item string, labels Labels) bool {
+			return labels["version"] != "1"
+		})]++
+	}
+	if count["B"] != 50 || count["D"] != 50 {
+		t.Fatalf("labeled select func wrong: %v", count)
+	}
+
+	items := lb.SelectNMatch(3, Labels{"version": "1"})
+	if len(items) != 2 || items[0] == items[1] || items[0] != "A" && items[0] != "C" {
+		t.Fatalf("labeled select n match wrong: %v", items)
+	}
+
+	if l := lb.Labels("A"); l["zone"] != "a" || l["version"] != "1" {
+		t.Fatalf("labeled labels wrong: %v", l)
+	}
+	lb.SetLabels("D", Labels{"zone": "b"})
+	if l := lb.Labels("D"); len(l) != 1 || l["zone"] != "b" {
+		t.Fatalf("labeled set labels wrong: %v", l)
+	}
+
+	// the retained items keep the labels
+	lb.Update(map[string]int{"A": 1, "C": 1})
+	if len(lb.Labels("A")) != 2 || len(lb.Labels("B")) != 0 || len(lb.Labels("D")) != 0 {
+		t.Fatal("labeled update wrong")
+	}
+	lb.Remove("A")
+	if len(lb.Labels("A")) != 0 || len(lb.Labels("C")) != 2 {
+		t.Fatal("labeled remove wrong")
+	}
+	lb.RemoveAll()
+	if len(lb.Labels("C")) != 0 {
+		t.Fatal("labeled remove all wrong")
+	}
+	if _, err := TrySelect(lb); err != ErrNoItems {
+		t.Fatalf("labeled error wrong: %v", err)
+	}
+}
+
+func TestLabeled_Modes(t *testing.T) {
+	wNodes := map[string]int{
+		"A": 1,
+		"B": 1,
+		"C": 1,
+		"D": 1,
+	}
+	nodes := []string{"A", "B", "C", "D"}
+	for m := WeightedRoundRobin; m <= Rendezvous; m++ {
+		lb := NewLabeled(New(m, wNodes, nodes))
+		lb.SetLabels("A", Labels{"canary": "true"})
+		lb.SetLabels("C", Labels{"canary": "true"})
+		seen := make(map[string]int)
+		for i := 0; i < 1000; i++ {
+			seen[lb.SelectMatch(Labels{"canary": "true"}, strconv.Itoa(i))]++
+		}
+		if len(seen) != 2 || seen["A"] < 300 || seen["C"] < 300 {
+			t.Fatalf("%s labeled select match wrong: %v", m, seen)
+		}
+	}
+}
+
+func TestLabeled_C(t *testing.T) {
+	lb := NewLabeled(NewRoundRobin())
+	lb.AddLabeled("A", Labels{"zone": "a"})
+	lb.AddLabeled("B", Labels{"zone": "b"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if i == 0 && j%10 == 0 {
+					lb.SetLabels("C", Labels{"zone": "a"})
+					lb.Update([]string{"A", "B", "C"})
+					continue
+				}
+				if item := lb.SelectMatch(Labels{"zone": "b"}); item != "B" {
+					t.Errorf("labeled expected B, actual %s", item)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
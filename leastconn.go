@@ -0,0 +1,247 @@
+package balancer
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// LeastConnections
+// Selects the item with the fewest in-flight requests, ties are broken in round-robin order.
+type leastConn struct {
+	items []*lcItem
+	count int
+	next  int
+
+	sync.Mutex
+}
+
+type lcItem struct {
+	item     string
+	inflight int64
+}
+
+func NewLeastConnections(items ...[]string) (lb *leastConn) {
+	lb = &leastConn{}
+	if len(items) > 0 && len(items[0]) > 0 {
+		lb.Update(items[0])
+	}
+	return
+}
+
+func (b *leastConn) Add(item string, _ ...int) {
+	b.Lock()
+	if b.indexOf(item) < 0 {
+		b.items = append(b.items, &lcItem{item: item})
+		b.count++
+	}
+	b.Unlock()
+}
+
+func (b *leastConn) All() interface{} {
+	b.Lock()
+	all := make([]string, b.count)
+	for i, v := range b.items {
+		all[i] = v.item
+	}
+	b.Unlock()
+
+	return all
+}
+
+func (b *leastConn) Name() string {
+	return "LeastConnections"
+}
+
+func (b *leastConn) Select(_ ...string) (item string) {
+	b.Lock()
+	if c := b.chooseNext(nil); c != nil {
+		item = c.item
+	}
+	b.Unlock()
+
+	return
+}
+
+// Acquire gets next selected item and counts an in-flight request on it.
+func (b *leastConn) Acquire(key ...string) (string, func()) {
+	return b.AcquireExcept(nil, key...)
+}
+
+// AcquireExcept gets next selected item other than the excluded items and counts an in-flight request on it.
+func (b *leastConn) AcquireExcept(exclude []string, _ ...string) (string, func()) {
+	b.Lock()
+	c := b.chooseNext(excluded(exclude))
+	if c == nil {
+		b.Unlock()
+		return "", noop
+	}
+	atomic.AddInt64(&c.inflight, 1)
+	b.Unlock()
+
+	return c.item, releaser(&c.inflight)
+}
+
+// SelectExcept gets the least loaded item other than the excluded items.
+func (b *leastConn) SelectExcept(exclude []string, _ ...string) (item string) {
+	skip := excluded(exclude)
+	if skip == nil {
+		return b.Select()
+	}
+
+	b.Lock()
+	if c := b.chooseNext(skip); c != nil {
+		item = c.item
+	}
+	b.Unlock()
+
+	return
+}
+
+// SelectN gets up to n distinct items in the order of the in-flight requests.
+func (b *leastConn) SelectN(n int, _ ...string) []string {
+	b.Lock()
+	defer b.Unlock()
+
+	p := newPicker(n, b.count)
+	if p.full() {
+		return nil
+	}
+	c := b.chooseNext(nil)
+	p.add(c.item)
+
+	// ties are in the same round-robin order as the next chooseNext
+	rest := make([]*lcItem, 0, b.count-1)
+	for i := 0; i < b.count; i++ {
+		if x := b.items[(b.next+i)%b.count]; x != c {
+			rest = append(rest, x)
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		return atomic.LoadInt64(&rest[i].inflight) < atomic.LoadInt64(&rest[j].inflight)
+	})
+	for _, x := range rest {
+		if p.add(x.item) {
+			break
+		}
+	}
+	return p.result()
+}
+
+func (b *leastConn) chooseNext(skip func(string) bool) (choice *lcItem) {
+	if b.count == 0 {
+		return nil
+	}
+
+	idx := 0
+	min := int64(0)
+	for n := 0; n < b.count; n++ {
+		i := (b.next + n) % b.count
+		if skip != nil && skip(b.items[i].item) {
+			continue
+		}
+		inflight := atomic.LoadInt64(&b.items[i].inflight)
+		if choice == nil || inflight < min {
+			choice = b.items[i]
+			min = inflight
+			idx = i
+		}
+	}
+	if choice != nil {
+		b.next = (idx + 1) % b.count
+	}
+
+	return
+}
+
+func (b *leastConn) indexOf(item string) int {
+	for i := 0; i < b.count; i++ {
+		if item == b.items[i].item {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *leastConn) Remove(item string, _ ...bool) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	i := b.indexOf(item)
+	if i < 0 {
+		return false
+	}
+	b.items = append(b.items[:i], b.items[i+1:]...)
+	b.count--
+	if b.next > i {
+		b.next--
+	}
+	if b.next >= b.count {
+		b.next = 0
+	}
+	return true
+}
+
+func (b *leastConn) RemoveAll() {
+	b.Lock()
+	b.items = b.items[:0]
+	b.count = 0
+	b.next = 0
+	b.Unlock()
+}
+
+func (b *leastConn) Reset() {
+	b.Lock()
+	b.next = 0
+	b.Unlock()
+}
+
+func (b *leastConn) Update(items interface{}) bool {
+	v, ok := items.([]string)
+	if !ok {
+		return false
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	// keep the in-flight counters of the retained items
+	old := make(map[string]*lcItem, b.count)
+	for _, x := range b.items {
+		old[x.item] = x
+	}
+
+	data := make([]*lcItem, 0, len(v))
+	seen := make(map[string]struct{}, len(v))
+	for _, item := range v {
+		if _, ok := seen[item]; ok {
+			continue
+		}
+		seen[item] = struct{}{}
+		if x, ok := old[item]; ok {
+			data = append(data, x)
+		} else {
+			data = append(data, &lcItem{item: item})
+		}
+	}
+
+	b.items = data
+	b.count = len(data)
+	b.next = 0
+
+	return true
+}
+
+// releaser returns a func that gives back the in-flight request counted on n, only the first call takes effect.
+func releaser(n ...*int64) func() {
+	var released int32
+	return func() {
+		if atomic.CompareAndSwapInt32(&released, 0, 1) {
+			for _, x := range n {
+				atomic.AddInt64(x, -1)
+			}
+		}
+	}
+}
+
+func noop() {}
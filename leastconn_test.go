@@ -0,0 +1,186 @@
+package balancer
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLeastConnections(t *testing.T) {
+	lb := NewLeastConnections()
+	item := lb.Select()
+	if item != "" {
+		t.Fatalf("lc expected empty, actual %s", item)
+	}
+	item, done := lb.Acquire()
+	if item != "" {
+		t.Fatalf("lc expected empty, actual %s", item)
+	}
+	done()
+
+	lb.Add("A")
+	item = lb.Select()
+	if item != "A" {
+		t.Fatalf("lc expected A, actual %s", item)
+	}
+
+	nodes := []string{"A", "B", "C", "D"}
+	lb = NewLeastConnections(nodes)
+
+	// without feedback, ties are broken in round-robin order
+	count := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		item := lb.Select()
+		count[item]++
+	}
+	if count["A"] != 500 || count["B"] != 500 || count["C"] != 500 || count["D"] != 500 {
+		t.Fatal("lc wrong")
+	}
+
+	a, doneA := lb.Acquire()
+	b, doneB := lb.Acquire()
+	c, doneC := lb.Acquire()
+	if a != "A" || b != "B" || c != "C" {
+		t.Fatalf("lc acquire wrong: %s %s %s", a, b, c)
+	}
+	for i := 0; i < 10; i++ {
+		item := lb.Select()
+		if item != "D" {
+			t.Fatalf("lc expected D, actual %s", item)
+		}
+	}
+
+	d, doneD := lb.Acquire()
+	if d != "D" {
+		t.Fatalf("lc expected D, actual %s", d)
+	}
+	doneB()
+	doneB()
+	for i := 0; i < 10; i++ {
+		item := lb.Select()
+		if item != "B" {
+			t.Fatalf("lc expected B, actual %s", item)
+		}
+	}
+	doneA()
+	doneC()
+	doneD()
+
+	lb.Add("A")
+	lb.Add("E")
+	all := lb.All().([]string)
+	if strings.Join(all, "") != "ABCDE" {
+		t.Fatal("lc all() wrong")
+	}
+
+	ok := lb.Remove("C")
+	if ok != true {
+		t.Fatal("lc remove() wrong")
+	}
+	ok = lb.Remove("C")
+	if ok != false {
+		t.Fatal("lc remove() wrong")
+	}
+	all = lb.All().([]string)
+	if strings.Join(all, "") != "ABDE" {
+		t.Fatal("lc all() wrong")
+	}
+
+	d, doneD = lb.Acquire()
+	if d != "D" {
+		t.Fatalf("lc expected D, actual %s", d)
+	}
+	ok = lb.Update([]string{"X", "D", "X"})
+	if ok != true {
+		t.Fatal("lc update wrong")
+	}
+	all = lb.All().([]string)
+	if strings.Join(all, "") != "XD" {
+		t.Fatal("lc update wrong")
+	}
+	for i := 0; i < 10; i++ {
+		item := lb.Select()
+		if item != "X" {
+			t.Fatalf("lc expected X, actual %s", item)
+		}
+	}
+	doneD()
+	item = lb.Select()
+	if item != "D" {
+		t.Fatalf("lc expected D, actual %s", item)
+	}
+
+	ok = lb.Update(map[string]int{"Y": 1})
+	if ok != false {
+		t.Fatal("lc update wrong")
+	}
+
+	lb.RemoveAll()
+	lb.Add("F", 1)
+	all, ok = lb.All().([]string)
+	if !ok || len(all) != 1 {
+		t.Fatal("lc all() wrong")
+	}
+}
+
+func TestLeastConnections_SelectN(t *testing.T) {
+	lb := NewLeastConnections([]string{"A", "B", "C", "D"})
+	_, doneA := lb.Acquire()
+	_, doneB := lb.Acquire()
+	_, doneC := lb.Acquire()
+	doneC()
+	lb.Acquire()
+	items := lb.SelectN(4)
+	if strings.Join(items, "") != "CDAB" {
+		t.Fatalf("lc expected CDAB, actual %v", items)
+	}
+	doneA()
+	doneB()
+	items = lb.SelectN(2)
+	if strings.Join(items, "") != "AB" {
+		t.Fatalf("lc expected AB, actual %v", items)
+	}
+}
+
+func TestLeastConnections_C(t *testing.T) {
+	nodes := []string{"A", "B", "C", "D"}
+	lb := NewLeastConnections(nodes)
+
+	var (
+		wg  sync.WaitGroup
+		max int64
+		cur = make(map[string]*int64)
+	)
+	for _, v := range nodes {
+		cur[v] = new(int64)
+	}
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				item, done := lb.Acquire()
+				n := atomic.AddInt64(cur[item], 1)
+				for {
+					m := atomic.LoadInt64(&max)
+					if n <= m || atomic.CompareAndSwapInt64(&max, m, n) {
+						break
+					}
+				}
+				atomic.AddInt64(cur[item], -1)
+				done()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, v := range lb.items {
+		if atomic.LoadInt64(&v.inflight) != 0 {
+			t.Fatalf("lc wrong: %s in-flight %d", v.item, v.inflight)
+		}
+	}
+	if atomic.LoadInt64(&max) > 500 {
+		t.Fatal("lc wrong: max")
+	}
+}
@@ -0,0 +1,241 @@
+package balancer
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/fufuok/balancer/utils"
+)
+
+// DefaultTableSize is the default lookup table size of Maglev, it must be a prime.
+const DefaultTableSize = 65537
+
+// Maglev consistent hashing
+// Each item takes turns filling its preferred slots of the lookup table, weighted items take more turns.
+// Ref: https://research.google/pubs/pub44824/
+type maglev struct {
+	table []string
+	size  uint64
+	all   map[string]int
+
+	sync.RWMutex
+}
+
+func NewMaglev(items ...map[string]int) (lb *maglev) {
+	lb = &maglev{
+		size: DefaultTableSize,
+		all:  make(map[string]int),
+	}
+	if len(items) > 0 && len(items[0]) > 0 {
+		lb.Update(items[0])
+	}
+	return
+}
+
+// SetTableSize sets the lookup table size, it must be a prime and should be much larger than the number of items.
+func (b *maglev) SetTableSize(size int) bool {
+	if !isPrime(size) {
+		return false
+	}
+
+	b.Lock()
+	b.size = uint64(size)
+	b.build()
+	b.Unlock()
+
+	return true
+}
+
+func (b *maglev) Add(item string, weight ...int) {
+	w := 1
+	if len(weight) > 0 {
+		w = weight[0]
+	}
+
+	b.Lock()
+	b.all[item] = w
+	b.build()
+	b.Unlock()
+}
+
+func (b *maglev) All() interface{} {
+	all := make(map[string]int)
+
+	b.RLock()
+	for k, v := range b.all {
+		all[k] = v
+	}
+	b.RUnlock()
+
+	return all
+}
+
+func (b *maglev) Name() string {
+	return "Maglev"
+}
+
+func (b *maglev) Select(key ...string) (item string) {
+	b.RLock()
+	if len(b.table) > 0 {
+		item = b.table[utils.HashString(key...)%b.size]
+	}
+	b.RUnlock()
+
+	return
+}
+
+// SelectN gets up to n distinct items in the order of the lookup table from the hash of the key.
+func (b *maglev) SelectN(n int, key ...string) []string {
+	b.RLock()
+	defer b.RUnlock()
+
+	p := newPicker(n, len(b.all))
+	if p.full() || len(b.table) == 0 {
+		return nil
+	}
+	start := utils.HashString(key...) % b.size
+	for i := uint64(0); i < b.size; i++ {
+		if p.add(b.table[(start+i)%b.size]) {
+			break
+		}
+	}
+	return p.result()
+}
+
+// SelectExcept gets the first item not excluded in the order of the lookup table from the hash of the key.
+func (b *maglev) SelectExcept(exclude []string, key ...string) string {
+	skip := excluded(exclude)
+	if skip == nil {
+		return b.Select(key...)
+	}
+
+	b.RLock()
+	defer b.RUnlock()
+
+	if len(b.table) == 0 {
+		return ""
+	}
+	start := utils.HashString(key...) % b.size
+	for i := uint64(0); i < b.size; i++ {
+		if x := b.table[(start+i)%b.size]; !skip(x) {
+			return x
+		}
+	}
+	return ""
+}
+
+func (b *maglev) Remove(item string, _ ...bool) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.all[item]; !ok {
+		return false
+	}
+	delete(b.all, item)
+	b.build()
+	return true
+}
+
+func (b *maglev) RemoveAll() {
+	b.Lock()
+	b.all = make(map[string]int)
+	b.build()
+	b.Unlock()
+}
+
+func (b *maglev) Reset() {}
+
+func (b *maglev) Update(items interface{}) bool {
+	v, ok := items.(map[string]int)
+	if !ok {
+		return false
+	}
+
+	all := make(map[string]int, len(v))
+	for item, weight := range v {
+		all[item] = weight
+	}
+
+	b.Lock()
+	b.all = all
+	b.build()
+	b.Unlock()
+
+	return true
+}
+
+// build populates the lookup table, see the Algorithm 1 of the paper.
+// Items are sorted by name, so that the table only depends on the items and weights.
+func (b *maglev) build() {
+	type permutation struct {
+		item   string
+		weight int
+		offset uint64
+		skip   uint64
+		next   uint64
+		credit int
+	}
+
+	var (
+		perms []*permutation
+		max   int
+	)
+	for item, weight := range b.all {
+		if weight <= 0 {
+			continue
+		}
+		perms = append(perms, &permutation{
+			item:   item,
+			weight: weight,
+			offset: utils.HashString(item) % b.size,
+			skip:   utils.HashString(item, "#maglev")%(b.size-1) + 1,
+		})
+		if weight > max {
+			max = weight
+		}
+	}
+	if len(perms) == 0 {
+		b.table = nil
+		return
+	}
+	sort.Slice(perms, func(i, j int) bool {
+		return perms[i].item < perms[j].item
+	})
+
+	table := make([]string, b.size)
+	filled := make([]bool, b.size)
+	for n := uint64(0); ; {
+		for _, p := range perms {
+			// an item of the max weight fills one slot per round
+			p.credit += p.weight
+			for p.credit >= max {
+				p.credit -= max
+				c := (p.offset + p.next*p.skip) % b.size
+				for filled[c] {
+					p.next++
+					c = (p.offset + p.next*p.skip) % b.size
+				}
+				table[c] = p.item
+				filled[c] = true
+				p.next++
+				n++
+				if n == b.size {
+					b.table = table
+					return
+				}
+			}
+		}
+	}
+}
+
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for i := 2; i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,192 @@
+package balancer
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMaglev(t *testing.T) {
+	lb := NewMaglev()
+	item := lb.Select()
+	if item != "" {
+		t.Fatalf("maglev expected empty, actual %s", item)
+	}
+
+	lb.Add("A", 0)
+	item = lb.Select()
+	if item != "" {
+		t.Fatalf("maglev expected empty, actual %s", item)
+	}
+	lb.Add("B")
+	item = lb.Select("192.168.1.100")
+	if item != "B" {
+		t.Fatalf("maglev expected B, actual %s", item)
+	}
+
+	nodes := map[string]int{
+		"A": 0,
+		"B": 1,
+		"C": 7,
+		"D": 2,
+	}
+	lb = NewMaglev(nodes)
+	count := make(map[string]int)
+	for _, v := range lb.table {
+		count[v]++
+	}
+	if count["A"] != 0 || count["B"] < 6500 || count["C"] < 45800 || count["D"] < 13100 {
+		t.Fatalf("maglev wrong: %v", count)
+	}
+	if count["B"]+count["C"]+count["D"] != DefaultTableSize {
+		t.Fatalf("maglev wrong: %v", count)
+	}
+
+	for i := 0; i < 2000; i++ {
+		item := lb.Select("192.168.1.100")
+		if item != lb.Select("192.168.1.100") {
+			t.Fatalf("maglev wrong: %s", item)
+		}
+	}
+
+	// removing an item barely disrupts the keys of the others
+	nodes = make(map[string]int)
+	for i := 0; i < 10; i++ {
+		nodes[strconv.Itoa(i)] = 1
+	}
+	lb.Update(nodes)
+	before := make(map[string]string)
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(i)
+		before[key] = lb.Select(key)
+	}
+	ok := lb.Remove("7")
+	if ok != true {
+		t.Fatal("maglev remove() wrong")
+	}
+	ok = lb.Remove("7")
+	if ok != false {
+		t.Fatal("maglev remove() wrong")
+	}
+	moved := 0
+	for key, v := range before {
+		item := lb.Select(key)
+		if item == "7" {
+			t.Fatalf("maglev unexpected %s", item)
+		}
+		if v != "7" && item != v {
+			moved++
+		}
+	}
+	if moved > 500 {
+		t.Fatalf("maglev moved too many keys: %d", moved)
+	}
+
+	// the table only depends on the items and weights
+	other := NewMaglev(lb.All().(map[string]int))
+	for i := range lb.table {
+		if lb.table[i] != other.table[i] {
+			t.Fatal("maglev table wrong")
+		}
+	}
+
+	ok = lb.SetTableSize(1000)
+	if ok != false {
+		t.Fatal("maglev set table size wrong")
+	}
+	ok = lb.SetTableSize(251)
+	if ok != true || len(lb.table) != 251 {
+		t.Fatal("maglev set table size wrong")
+	}
+
+	ok = lb.Update([]string{"X"})
+	if ok != false {
+		t.Fatal("maglev update wrong")
+	}
+
+	lb.RemoveAll()
+	lb.Add("F", 2)
+	lb.Add("F", 1)
+	all, ok := lb.All().(map[string]int)
+	if !ok || all["F"] != 1 {
+		t.Fatal("maglev all() wrong")
+	}
+
+	nodes = map[string]int{
+		"X": 0,
+		"Y": 1,
+	}
+	ok = lb.Update(nodes)
+	if ok != true {
+		t.Fatal("maglev update wrong")
+	}
+	item = lb.Select("192.168.1.100")
+	if item != "Y" {
+		t.Fatal("maglev update wrong")
+	}
+}
+
+func TestMaglev_SelectN(t *testing.T) {
+	lb := NewMaglev(map[string]int{
+		"A": 1,
+		"B": 1,
+		"C": 1,
+		"D": 1,
+	})
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		items := lb.SelectN(3, key)
+		if len(items) != 3 || items[0] != lb.Select(key) {
+			t.Fatalf("maglev select n wrong: %v", items)
+		}
+		if items[0] == items[1] || items[1] == items[2] || items[0] == items[2] {
+			t.Fatalf("maglev select n wrong: %v", items)
+		}
+	}
+}
+
+func TestMaglev_Update(t *testing.T) {
+	nodes := map[string]int{"A": 1, "B": 1}
+	lb := NewMaglev(nodes)
+
+	// the map of the caller is not changed
+	lb.Add("X", 3)
+	lb.Remove("A")
+	if len(nodes) != 2 || nodes["A"] != 1 || nodes["B"] != 1 {
+		t.Fatalf("maglev update wrong: %v", nodes)
+	}
+	if all := lb.All().(map[string]int); len(all) != 2 || all["X"] != 3 {
+		t.Fatalf("maglev all wrong: %v", all)
+	}
+}
+
+func TestMaglev_C(t *testing.T) {
+	var c int64
+	nodes := map[string]int{
+		"A": 1,
+		"B": 1,
+		"C": 1,
+		"D": 1,
+	}
+	lb := NewMaglev(nodes)
+	expected := lb.Select("192.168.1.7")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				if lb.Select("192.168.1.7") == expected {
+					atomic.AddInt64(&c, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt64(&c) != 1000000 {
+		t.Fatalf("maglev expected %s == 1000000, actual %d", expected, atomic.LoadInt64(&c))
+	}
+}
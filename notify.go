@@ -0,0 +1,167 @@
+package balancer
+
+import (
+	"sync"
+)
+
+// Change is a change of the items of a balancer, the weights of the items not weighted
+// are the number of times they are added.
+type Change struct {
+	// Added the new items and the weights
+	Added map[string]int
+
+	// Removed the removed items and the last weights
+	Removed map[string]int
+
+	// Reweighted the items of which the weights are changed, and the new weights
+	Reweighted map[string]int
+}
+
+// Empty reports whether nothing is changed.
+func (c Change) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Reweighted) == 0
+}
+
+// Notifier
+// Wraps a balancer, calls the listeners with the added, removed and reweighted items
+// whenever Add/Remove/RemoveAll/Update/SetWeight changes the items.
+type notifier struct {
+	Balancer
+
+	listeners map[int]func(Change)
+	next      int
+
+	// serializes the changes and the listeners
+	sync.Mutex
+}
+
+// NewNotifier wraps the balancer with the change notifications.
+func NewNotifier(lb Balancer) *notifier {
+	return &notifier{
+		Balancer:  lb,
+		listeners: make(map[int]func(Change)),
+	}
+}
+
+// Subscribe registers the listener of the changes, cancel unregisters it.
+// The listeners are called in the order of the changes, and must not change the items of the balancer.
+func (b *notifier) Subscribe(fn func(Change)) (cancel func()) {
+	b.Lock()
+	id := b.next
+	b.next++
+	b.listeners[id] = fn
+	b.Unlock()
+
+	return func() {
+		b.Lock()
+		delete(b.listeners, id)
+		b.Unlock()
+	}
+}
+
+// change runs fn, and calls the listeners if the items are changed.
+func (b *notifier) change(fn func()) {
+	b.Lock()
+	defer b.Unlock()
+
+	if len(b.listeners) == 0 {
+		fn()
+		return
+	}
+	before := weightsOf(b.Balancer.All())
+	fn()
+	c := diffWeights(before, weightsOf(b.Balancer.All()))
+	if c.Empty() {
+		return
+	}
+	for _, l := range b.listeners {
+		l(c)
+	}
+}
+
+// SelectN gets up to n distinct items in the order of preference.
+func (b *notifier) SelectN(n int, key ...string) []string {
+	return selectN(b.Balancer, n, key...)
+}
+
+// SelectExcept gets next selected item other than the excluded items.
+func (b *notifier) SelectExcept(exclude []string, key ...string) string {
+	return selectExcept(b.Balancer, exclude, key...)
+}
+
+func (b *notifier) Add(item string, weight ...int) {
+	b.change(func() {
+		b.Balancer.Add(item, weight...)
+	})
+}
+
+func (b *notifier) Remove(item string, asClean ...bool) (ok bool) {
+	b.change(func() {
+		ok = b.Balancer.Remove(item, asClean...)
+	})
+	return
+}
+
+func (b *notifier) RemoveAll() {
+	b.change(func() {
+		b.Balancer.RemoveAll()
+	})
+}
+
+func (b *notifier) Update(items interface{}) (ok bool) {
+	b.change(func() {
+		ok = b.Balancer.Update(items)
+	})
+	return
+}
+
+// SetWeight sets the weight of the item if the balancer is a Weighter, or replaces it by Add if the items are weighted,
+// otherwise adds the item of a positive weight if not exists, or removes it.
+func (b *notifier) SetWeight(item string, weight int) {
+	b.change(func() {
+		if w, ok := b.Balancer.(Weighter); ok {
+			w.SetWeight(item, weight)
+			return
+		}
+		switch all := b.Balancer.All().(type) {
+		case map[string]int:
+			b.Balancer.Add(item, weight)
+		case []string:
+			if weight <= 0 {
+				b.Balancer.Remove(item, true)
+				return
+			}
+			if _, ok := weightsOf(all)[item]; !ok {
+				b.Balancer.Add(item, weight)
+			}
+		}
+	})
+}
+
+// diffWeights gets the change from the weights before to after.
+func diffWeights(before, after map[string]int) (c Change) {
+	for item, w := range after {
+		old, ok := before[item]
+		switch {
+		case !ok:
+			if c.Added == nil {
+				c.Added = make(map[string]int)
+			}
+			c.Added[item] = w
+		case old != w:
+			if c.Reweighted == nil {
+				c.Reweighted = make(map[string]int)
+			}
+			c.Reweighted[item] = w
+		}
+	}
+	for item, w := range before {
+		if _, ok := after[item]; !ok {
+			if c.Removed == nil {
+				c.Removed = make(map[string]int)
+			}
+			c.Removed[item] = w
+		}
+	}
+	return
+}
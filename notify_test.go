@@ -0,0 +1,125 @@
+package balancer
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNotifier(t *testing.T) {
+	lb := NewNotifier(NewSmoothWeightedRoundRobin())
+	var changes []Change
+	cancel := lb.Subscribe(func(c Change) {
+		changes = append(changes, c)
+	})
+
+	lb.Add("A", 1)
+	lb.Add("B", 2)
+	lb.Add("B", 2)
+	if len(changes) != 2 || changes[0].Added["A"] != 1 || changes[1].Added["B"] != 2 {
+		t.Fatalf("notifier add wrong: %v", changes)
+	}
+
+	lb.SetWeight("A", 3)
+	if len(changes) != 3 || changes[2].Reweighted["A"] != 3 || len(changes[2].Added) != 0 {
+		t.Fatalf("notifier set weight wrong: %v", changes)
+	}
+
+	lb.Update(map[string]int{
+		"A": 3,
+		"B": 1,
+		"C": 1,
+	})
+	c := changes[3]
+	if len(changes) != 4 || c.Added["C"] != 1 || c.Reweighted["B"] != 1 || len(c.Removed) != 0 {
+		t.Fatalf("notifier update wrong: %v", changes)
+	}
+
+	if lb.Remove("X") || len(changes) != 4 {
+		t.Fatal("notifier remove wrong")
+	}
+	lb.Remove("C")
+	if len(changes) != 5 || changes[4].Removed["C"] != 1 {
+		t.Fatalf("notifier remove wrong: %v", changes)
+	}
+
+	cancel()
+	lb.RemoveAll()
+	if len(changes) != 5 || len(lb.All().(map[string]int)) != 0 {
+		t.Fatal("notifier cancel wrong")
+	}
+}
+
+func TestNotifier_Items(t *testing.T) {
+	lb := NewNotifier(NewRoundRobin())
+	var changes []Change
+	lb.Subscribe(func(c Change) {
+		changes = append(changes, c)
+	})
+
+	lb.Update([]string{"A", "B"})
+	lb.Add("A")
+	if len(changes) != 2 || len(changes[0].Added) != 2 || changes[1].Reweighted["A"] != 2 {
+		t.Fatalf("notifier wrong: %v", changes)
+	}
+
+	// not a Weighter
+	lb.SetWeight("C", 5)
+	lb.SetWeight("A", 0)
+	if len(changes) != 4 || changes[2].Added["C"] != 1 || changes[3].Removed["A"] != 2 {
+		t.Fatalf("notifier set weight wrong: %v", changes)
+	}
+	if item, err := TrySelect(lb); err != nil || item == "" {
+		t.Fatal("notifier select wrong")
+	}
+	lb.RemoveAll()
+	if _, err := TrySelect(lb); err != ErrNoItems {
+		t.Fatalf("notifier error wrong: %v", err)
+	}
+}
+
+func TestNotifier_Weighted(t *testing.T) {
+	for _, inner := range []Balancer{NewRingHash(), NewMaglev(), NewConsistentHash(map[string]int{})} {
+		lb := NewNotifier(inner)
+		lb.Update(map[string]int{"A": 1, "B": 1})
+		var changes []Change
+		lb.Subscribe(func(c Change) {
+			changes = append(changes, c)
+		})
+
+		// not a Weighter, the weight is replaced by Add
+		lb.SetWeight("A", 5)
+		if len(changes) != 1 || changes[0].Reweighted["A"] != 5 || lb.All().(map[string]int)["A"] != 5 {
+			t.Fatalf("%s notifier set weight wrong: %v", inner.Name(), changes)
+		}
+		lb.SetWeight("C", 2)
+		if len(changes) != 2 || changes[1].Added["C"] != 2 {
+			t.Fatalf("%s notifier set weight wrong: %v", inner.Name(), changes)
+		}
+	}
+}
+
+func TestNotifier_C(t *testing.T) {
+	var n int64
+	lb := NewNotifier(NewWeightedRoundRobin())
+	lb.Subscribe(func(c Change) {
+		atomic.AddInt64(&n, int64(len(c.Added)))
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				lb.Add(string(rune('A'+j%26)), i)
+				lb.Select()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if atomic.LoadInt64(&n) != 26 {
+		t.Fatalf("notifier expected 26, actual %d", atomic.LoadInt64(&n))
+	}
+}
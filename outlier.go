@@ -0,0 +1,354 @@
+package balancer
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultConsecutiveErrors is the default number of consecutive failures to eject an item.
+	DefaultConsecutiveErrors = 5
+
+	// DefaultEjectionTime is the default base ejection time, the n-th ejection in a row lasts n times longer.
+	DefaultEjectionTime = 30 * time.Second
+
+	// DefaultMaxEjectionTime is the default max ejection time.
+	DefaultMaxEjectionTime = 300 * time.Second
+
+	// DefaultOutlierInterval is the default interval of the error rate statistics.
+	DefaultOutlierInterval = 10 * time.Second
+)
+
+// OutlierDetection
+// Wraps a balancer, ejects an item after consecutive failures or a too high error rate reported,
+// and re-admits it after an ejection time growing with the number of ejections in a row.
+// Ejected items are passed over by SelectExcept of the balancer, the items themselves are untouched.
+// Ref: https://www.envoyproxy.io/docs/envoy/latest/intro/arch_overview/upstream/outlier
+type outlierDetection struct {
+	Balancer
+
+	consecutive  int
+	rate         float64
+	minRequests  int
+	interval     time.Duration
+	ejectionTime time.Duration
+	maxEjection  time.Duration
+	panic        float64
+
+	stats   map[string]*outlierStat
+	ejected map[string]time.Time
+
+	// the clock, replaced by the tests
+	now func() time.Time
+
+	sync.Mutex
+}
+
+type outlierStat struct {
+	consecutive int
+	successes   int
+	failures    int
+	since       time.Time
+	ejections   int
+	until       time.Time
+}
+
+// NewOutlierDetection wraps the balancer with the outlier detection,
+// by default an item is ejected after 5 consecutive failures, the error rate is disabled.
+func NewOutlierDetection(lb Balancer) *outlierDetection {
+	return &outlierDetection{
+		Balancer:     lb,
+		consecutive:  DefaultConsecutiveErrors,
+		interval:     DefaultOutlierInterval,
+		ejectionTime: DefaultEjectionTime,
+		maxEjection:  DefaultMaxEjectionTime,
+		stats:        make(map[string]*outlierStat),
+		ejected:      make(map[string]time.Time),
+		now:          time.Now,
+	}
+}
+
+// SetConsecutiveErrors sets the number of consecutive failures to eject an item, 0 disables it.
+func (b *outlierDetection) SetConsecutiveErrors(n int) {
+	if n < 0 {
+		n = 0
+	}
+	b.Lock()
+	b.consecutive = n
+	b.Unlock()
+}
+
+// SetErrorRate sets the error rate (0, 1] to eject an item, counted in each interval
+// once the item has at least minRequests reports. 0 disables it.
+func (b *outlierDetection) SetErrorRate(rate float64, minRequests int, interval ...time.Duration) {
+	if rate < 0 || rate > 1 {
+		rate = 0
+	}
+	if minRequests < 1 {
+		minRequests = 1
+	}
+	b.Lock()
+	b.rate = rate
+	b.minRequests = minRequests
+	if len(interval) > 0 && interval[0] > 0 {
+		b.interval = interval[0]
+	}
+	b.Unlock()
+}
+
+// SetEjectionTime sets the base and the max ejection time.
+func (b *outlierDetection) SetEjectionTime(base, max time.Duration) {
+	if base <= 0 {
+		base = DefaultEjectionTime
+	}
+	if max < base {
+		max = base
+	}
+	b.Lock()
+	b.ejectionTime = base
+	b.maxEjection = max
+	b.Unlock()
+}
+
+// SetPanicThreshold sets the min percent (0, 1] of the items not ejected, e.g. 0.5, 0 disables it (default).
+// Below the threshold, the balancer selects across all the items, instead of overloading the few healthy ones.
+func (b *outlierDetection) SetPanicThreshold(threshold float64) {
+	if threshold < 0 || threshold > 1 {
+		threshold = 0
+	}
+	b.Lock()
+	b.panic = threshold
+	b.Unlock()
+}
+
+// Status gets the ejected items of the balancer.
+func (b *outlierDetection) Status() HealthStatus {
+	items := itemsOf(b.Balancer.All())
+
+	b.Lock()
+	defer b.Unlock()
+
+	ejected := b.ejectedOf(items)
+	return HealthStatus{
+		Total:     len(items),
+		Unhealthy: ejected,
+		Panic:     panicking(b.panic, len(items), len(ejected)),
+	}
+}
+
+// ejectedOf gets the ejected ones of the items.
+func (b *outlierDetection) ejectedOf(items []string) []string {
+	in := excluded(items)
+	if in == nil {
+		return nil
+	}
+	var ejected []string
+	for _, item := range b.ejectedItems() {
+		if in(item) {
+			ejected = append(ejected, item)
+		}
+	}
+	return ejected
+}
+
+// skipped gets the items to skip, none in the panic mode.
+func (b *outlierDetection) skipped() []string {
+	b.Lock()
+	ejected := b.ejectedItems()
+	threshold := b.panic
+	b.Unlock()
+
+	if len(ejected) == 0 || threshold == 0 {
+		return ejected
+	}
+
+	// the items may be updated without the outlier detection
+	items := itemsOf(b.Balancer.All())
+	b.Lock()
+	defer b.Unlock()
+
+	ejected = b.ejectedOf(items)
+	if panicking(threshold, len(items), len(ejected)) {
+		return nil
+	}
+	return ejected
+}
+
+// Success reports a successful request to the item.
+func (b *outlierDetection) Success(item string) {
+	b.report(item, true)
+}
+
+// Failure reports a failed request to the item.
+func (b *outlierDetection) Failure(item string) {
+	b.report(item, false)
+}
+
+func (b *outlierDetection) report(item string, ok bool) {
+	b.Lock()
+	_, found := b.stats[item]
+	b.Unlock()
+
+	// the reports of the items not in the balancer are ignored
+	if !found {
+		if _, in := weightsOf(b.Balancer.All())[item]; !in {
+			return
+		}
+	}
+
+	now := b.now()
+
+	b.Lock()
+	defer b.Unlock()
+
+	s, found := b.stats[item]
+	if !found {
+		s = &outlierStat{since: now}
+		b.stats[item] = s
+	}
+	if now.Sub(s.since) >= b.interval {
+		s.successes, s.failures, s.since = 0, 0, now
+	}
+	if now.Before(s.until) {
+		// reports of the requests in flight when ejected
+		return
+	}
+
+	if ok {
+		s.consecutive = 0
+		s.successes++
+		return
+	}
+	s.consecutive++
+	s.failures++
+
+	switch {
+	case b.consecutive > 0 && s.consecutive >= b.consecutive:
+	case b.rate > 0 && s.successes+s.failures >= b.minRequests &&
+		float64(s.failures) >= b.rate*float64(s.successes+s.failures):
+	default:
+		return
+	}
+	b.eject(item, s, now)
+}
+
+// eject ejects the item for base * the number of ejections in a row,
+// the number decreases by one for each interval passed without ejection.
+func (b *outlierDetection) eject(item string, s *outlierStat, now time.Time) {
+	if !s.until.IsZero() {
+		s.ejections -= int(now.Sub(s.until) / b.interval)
+		if s.ejections < 0 {
+			s.ejections = 0
+		}
+	}
+	s.ejections++
+
+	d := b.maxEjection
+	if s.ejections <= int(b.maxEjection/b.ejectionTime) {
+		d = time.Duration(s.ejections) * b.ejectionTime
+	}
+	s.until = now.Add(d)
+	s.consecutive, s.successes, s.failures, s.since = 0, 0, 0, s.until
+	b.ejected[item] = s.until
+}
+
+// Ejected gets the items ejected now.
+func (b *outlierDetection) Ejected() []string {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.ejectedItems()
+}
+
+// ejectedItems re-admits the items of the ejection time passed, and returns the rest.
+func (b *outlierDetection) ejectedItems() []string {
+	if len(b.ejected) == 0 {
+		return nil
+	}
+	now := b.now()
+	items := make([]string, 0, len(b.ejected))
+	for item, until := range b.ejected {
+		if now.Before(until) {
+			items = append(items, item)
+		} else {
+			delete(b.ejected, item)
+		}
+	}
+	return items
+}
+
+// Select gets next selected item other than the ejected items.
+func (b *outlierDetection) Select(key ...string) string {
+	ejected := b.skipped()
+
+	if len(ejected) == 0 {
+		return b.Balancer.Select(key...)
+	}
+	return selectExcept(b.Balancer, ejected, key...)
+}
+
+// SelectN gets up to n distinct items other than the ejected items.
+func (b *outlierDetection) SelectN(n int, key ...string) []string {
+	ejected := b.skipped()
+
+	return selectNExcept(b.Balancer, n, ejected, key...)
+}
+
+// SelectExcept gets next selected item other than the excluded and the ejected items.
+func (b *outlierDetection) SelectExcept(exclude []string, key ...string) string {
+	ejected := b.skipped()
+
+	return selectExcept(b.Balancer, append(ejected, exclude...), key...)
+}
+
+// Acquire gets next selected item other than the ejected items and counts an in-flight request on it,
+// done is a no-op if the balancer does not count the in-flight requests.
+func (b *outlierDetection) Acquire(key ...string) (string, func()) {
+	return acquireExcept(b.Balancer, b.skipped(), key...)
+}
+
+// AcquireExcept gets next selected item other than the excluded and the ejected items
+// and counts an in-flight request on it.
+func (b *outlierDetection) AcquireExcept(exclude []string, key ...string) (string, func()) {
+	return acquireExcept(b.Balancer, append(b.skipped(), exclude...), key...)
+}
+
+func (b *outlierDetection) Remove(item string, asClean ...bool) bool {
+	b.Lock()
+	delete(b.stats, item)
+	delete(b.ejected, item)
+	b.Unlock()
+
+	return b.Balancer.Remove(item, asClean...)
+}
+
+func (b *outlierDetection) RemoveAll() {
+	b.Lock()
+	b.stats = make(map[string]*outlierStat)
+	b.ejected = make(map[string]time.Time)
+	b.Unlock()
+
+	b.Balancer.RemoveAll()
+}
+
+// Update reinitializes the items, the removed items are forgotten.
+func (b *outlierDetection) Update(items interface{}) bool {
+	ok := b.Balancer.Update(items)
+	b.prune()
+
+	return ok
+}
+
+// prune removes the stats of the items not in the balancer.
+func (b *outlierDetection) prune() {
+	all := weightsOf(b.Balancer.All())
+
+	b.Lock()
+	for item := range b.stats {
+		if _, ok := all[item]; !ok {
+			delete(b.stats, item)
+			delete(b.ejected, item)
+		}
+	}
+	b.Unlock()
+}
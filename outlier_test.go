@@ -0,0 +1,205 @@
+package balancer
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOutlierDetection(t *testing.T) {
+	lb := NewOutlierDetection(NewRoundRobin([]string{"A", "B", "C"}))
+	if lb.Name() != "RoundRobin" {
+		t.Fatal("outlier name wrong")
+	}
+	clock := newFakeClock()
+	lb.now = clock.Now
+	lb.SetEjectionTime(50*time.Millisecond, 120*time.Millisecond)
+
+	// consecutive failures
+	for i := 0; i < DefaultConsecutiveErrors-1; i++ {
+		lb.Failure("B")
+	}
+	lb.Success("B")
+	for i := 0; i < DefaultConsecutiveErrors-1; i++ {
+		lb.Failure("B")
+	}
+	if len(lb.Ejected()) != 0 {
+		t.Fatal("outlier ejected wrong")
+	}
+	lb.Failure("B")
+	ejected := lb.Ejected()
+	if len(ejected) != 1 || ejected[0] != "B" {
+		t.Fatalf("outlier ejected wrong: %v", ejected)
+	}
+	for i := 0; i < 100; i++ {
+		item := lb.Select()
+		if item == "B" {
+			t.Fatalf("outlier unexpected %s", item)
+		}
+	}
+	items := lb.SelectN(3)
+	if len(items) != 2 || strings.Contains(strings.Join(items, ""), "B") {
+		t.Fatalf("outlier select n wrong: %v", items)
+	}
+	item := lb.SelectExcept([]string{"A"})
+	if item != "C" {
+		t.Fatalf("outlier expected C, actual %s", item)
+	}
+
+	// re-admitted after the ejection time
+	clock.Add(60 * time.Millisecond)
+	if len(lb.Ejected()) != 0 {
+		t.Fatal("outlier re-admission wrong")
+	}
+	count := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		count[lb.Select()]++
+	}
+	if count["A"] != 10 || count["B"] != 10 || count["C"] != 10 {
+		t.Fatalf("outlier re-admission wrong: %v", count)
+	}
+
+	// the ejection time grows with the ejections in a row, up to the max
+	lb.SetConsecutiveErrors(1)
+	lb.Failure("B")
+	clock.Add(70 * time.Millisecond)
+	if len(lb.Ejected()) != 1 {
+		t.Fatal("outlier ejection time wrong")
+	}
+	clock.Add(60 * time.Millisecond)
+	if len(lb.Ejected()) != 0 {
+		t.Fatal("outlier ejection time wrong")
+	}
+	lb.Failure("B")
+	clock.Add(100 * time.Millisecond)
+	if len(lb.Ejected()) != 1 {
+		t.Fatal("outlier max ejection time wrong")
+	}
+	clock.Add(50 * time.Millisecond)
+	if len(lb.Ejected()) != 0 {
+		t.Fatal("outlier max ejection time wrong")
+	}
+
+	// error rate
+	lb.SetConsecutiveErrors(0)
+	lb.SetErrorRate(0.5, 10)
+	for i := 0; i < 6; i++ {
+		lb.Success("C")
+		lb.Failure("C")
+		if i < 4 && len(lb.Ejected()) != 0 {
+			t.Fatal("outlier error rate wrong")
+		}
+	}
+	ejected = lb.Ejected()
+	if len(ejected) != 1 || ejected[0] != "C" {
+		t.Fatalf("outlier error rate wrong: %v", ejected)
+	}
+
+	// all ejected
+	lb.SetConsecutiveErrors(1)
+	lb.Failure("A")
+	lb.Failure("B")
+	item = lb.Select()
+	if item != "" {
+		t.Fatalf("outlier expected empty, actual %s", item)
+	}
+
+	ok := lb.Remove("A")
+	if ok != true || len(lb.Ejected()) != 2 {
+		t.Fatal("outlier remove() wrong")
+	}
+	lb.RemoveAll()
+	if len(lb.Ejected()) != 0 || len(lb.All().([]string)) != 0 {
+		t.Fatal("outlier remove all wrong")
+	}
+}
+
+func TestOutlierDetection_Update(t *testing.T) {
+	lb := NewOutlierDetection(NewRoundRobin([]string{"A", "B", "C"}))
+	lb.SetConsecutiveErrors(1)
+	lb.Failure("A")
+	lb.Success("B")
+
+	// the items not in the balancer are ignored
+	lb.Failure("X")
+	if len(lb.stats) != 2 || len(lb.Ejected()) != 1 {
+		t.Fatalf("outlier detection stats wrong: %v", lb.stats)
+	}
+
+	// and the removed items are forgotten
+	lb.Update([]string{"B", "C", "D"})
+	if len(lb.stats) != 1 || lb.stats["B"] == nil || len(lb.Ejected()) != 0 {
+		t.Fatalf("outlier detection update wrong: %v", lb.stats)
+	}
+
+	lb.Update([]string{"A", "B"})
+	for i := 0; i < 10; i++ {
+		if item := lb.Select(); item == "" {
+			t.Fatal("outlier detection update wrong")
+		}
+	}
+	if ok := lb.Update(map[string]int{"A": 1}); ok {
+		t.Fatal("outlier detection update wrong")
+	}
+}
+
+func TestOutlierDetection_C(t *testing.T) {
+	var b int64
+	lb := NewOutlierDetection(NewSmoothWeightedRoundRobin(map[string]int{
+		"A": 1,
+		"B": 2,
+		"C": 3,
+	}))
+	lb.SetConsecutiveErrors(10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				item := lb.Select()
+				if item == "B" {
+					atomic.AddInt64(&b, 1)
+					lb.Failure(item)
+				} else {
+					lb.Success(item)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt64(&b) > 500*10 {
+		t.Fatalf("outlier wrong: B %d", atomic.LoadInt64(&b))
+	}
+	ejected := lb.Ejected()
+	if len(ejected) != 1 || ejected[0] != "B" {
+		t.Fatalf("outlier wrong: %v", ejected)
+	}
+}
+
+// fakeClock is a clock moved by the tests only.
+type fakeClock struct {
+	now time.Time
+	sync.Mutex
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.Lock()
+	c.now = c.now.Add(d)
+	c.Unlock()
+}
@@ -0,0 +1,255 @@
+package balancer
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fufuok/balancer/utils"
+)
+
+// LoadFunc returns the current load of an item, the lower the better.
+type LoadFunc func(item string) int64
+
+// PowerOfTwoChoices
+// Samples two items at random and selects the less loaded one.
+// Ref: https://www.eecs.harvard.edu/~michaelm/postscripts/mythesis.pdf
+type p2c struct {
+	items []*p2cItem
+	count uint32
+	load  LoadFunc
+
+	sync.RWMutex
+}
+
+type p2cItem struct {
+	item     string
+	inflight int64
+}
+
+func NewPowerOfTwoChoices(items ...[]string) (lb *p2c) {
+	lb = &p2c{}
+	if len(items) > 0 && len(items[0]) > 0 {
+		lb.Update(items[0])
+	}
+	return
+}
+
+// SetLoadFunc sets the load metric used to compare the two sampled items.
+// nil restores the built-in in-flight counter which is fed by Acquire.
+func (b *p2c) SetLoadFunc(fn LoadFunc) {
+	b.Lock()
+	b.load = fn
+	b.Unlock()
+}
+
+func (b *p2c) Add(item string, _ ...int) {
+	b.Lock()
+	if b.indexOf(item) < 0 {
+		b.items = append(b.items, &p2cItem{item: item})
+		b.count++
+	}
+	b.Unlock()
+}
+
+func (b *p2c) All() interface{} {
+	b.RLock()
+	all := make([]string, b.count)
+	for i, v := range b.items {
+		all[i] = v.item
+	}
+	b.RUnlock()
+
+	return all
+}
+
+func (b *p2c) Name() string {
+	return "PowerOfTwoChoices"
+}
+
+func (b *p2c) Select(_ ...string) (item string) {
+	b.RLock()
+	if c := b.chooseNext(nil); c != nil {
+		item = c.item
+	}
+	b.RUnlock()
+
+	return
+}
+
+// Acquire gets next selected item and counts an in-flight request on it.
+func (b *p2c) Acquire(key ...string) (string, func()) {
+	return b.AcquireExcept(nil, key...)
+}
+
+// AcquireExcept gets next selected item other than the excluded items and counts an in-flight request on it.
+func (b *p2c) AcquireExcept(exclude []string, _ ...string) (string, func()) {
+	b.RLock()
+	c := b.chooseNext(excluded(exclude))
+	if c == nil {
+		b.RUnlock()
+		return "", noop
+	}
+	atomic.AddInt64(&c.inflight, 1)
+	b.RUnlock()
+
+	return c.item, releaser(&c.inflight)
+}
+
+// SelectExcept gets the less loaded one of two items sampled other than the excluded items.
+func (b *p2c) SelectExcept(exclude []string, _ ...string) (item string) {
+	skip := excluded(exclude)
+	if skip == nil {
+		return b.Select()
+	}
+
+	b.RLock()
+	if c := b.chooseNext(skip); c != nil {
+		item = c.item
+	}
+	b.RUnlock()
+
+	return
+}
+
+// SelectN gets up to n distinct items, the selected item and then the rest in the order of load.
+func (b *p2c) SelectN(n int, _ ...string) []string {
+	b.RLock()
+	defer b.RUnlock()
+
+	p := newPicker(n, int(b.count))
+	if p.full() {
+		return nil
+	}
+	c := b.chooseNext(nil)
+	p.add(c.item)
+
+	type load struct {
+		item string
+		load int64
+	}
+	rest := make([]load, 0, b.count-1)
+	for _, x := range b.items {
+		if x != c {
+			rest = append(rest, load{x.item, b.loadOf(x)})
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		return rest[i].load < rest[j].load
+	})
+	for _, x := range rest {
+		if p.add(x.item) {
+			break
+		}
+	}
+	return p.result()
+}
+
+// chooseNext samples two items among the ones not skipped.
+func (b *p2c) chooseNext(skip func(string) bool) *p2cItem {
+	items := b.items
+	if skip != nil {
+		items = make([]*p2cItem, 0, b.count)
+		for _, c := range b.items {
+			if !skip(c.item) {
+				items = append(items, c)
+			}
+		}
+	}
+	switch len(items) {
+	case 0:
+		return nil
+	case 1:
+		return items[0]
+	}
+
+	i, j := sampleTwo(uint32(len(items)))
+	x, y := items[i], items[j]
+	if b.loadOf(y) < b.loadOf(x) {
+		return y
+	}
+	return x
+}
+
+// sampleTwo returns two distinct random indexes less than n, n must be greater than 1.
+func sampleTwo(n uint32) (uint32, uint32) {
+	i := utils.FastRandn(n)
+	j := utils.FastRandn(n - 1)
+	if j >= i {
+		j++
+	}
+	return i, j
+}
+
+func (b *p2c) loadOf(c *p2cItem) int64 {
+	if b.load != nil {
+		return b.load(c.item)
+	}
+	return atomic.LoadInt64(&c.inflight)
+}
+
+func (b *p2c) indexOf(item string) int {
+	for i := uint32(0); i < b.count; i++ {
+		if item == b.items[i].item {
+			return int(i)
+		}
+	}
+	return -1
+}
+
+func (b *p2c) Remove(item string, _ ...bool) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	i := b.indexOf(item)
+	if i < 0 {
+		return false
+	}
+	b.items = append(b.items[:i], b.items[i+1:]...)
+	b.count--
+	return true
+}
+
+func (b *p2c) RemoveAll() {
+	b.Lock()
+	b.items = b.items[:0]
+	b.count = 0
+	b.Unlock()
+}
+
+func (b *p2c) Reset() {}
+
+func (b *p2c) Update(items interface{}) bool {
+	v, ok := items.([]string)
+	if !ok {
+		return false
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	// keep the in-flight counters of the retained items
+	old := make(map[string]*p2cItem, b.count)
+	for _, x := range b.items {
+		old[x.item] = x
+	}
+
+	data := make([]*p2cItem, 0, len(v))
+	seen := make(map[string]struct{}, len(v))
+	for _, item := range v {
+		if _, ok := seen[item]; ok {
+			continue
+		}
+		seen[item] = struct{}{}
+		if x, ok := old[item]; ok {
+			data = append(data, x)
+		} else {
+			data = append(data, &p2cItem{item: item})
+		}
+	}
+
+	b.items = data
+	b.count = uint32(len(data))
+
+	return true
+}
@@ -0,0 +1,191 @@
+package balancer
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPowerOfTwoChoices(t *testing.T) {
+	lb := NewPowerOfTwoChoices()
+	item := lb.Select()
+	if item != "" {
+		t.Fatalf("p2c expected empty, actual %s", item)
+	}
+	item, done := lb.Acquire()
+	if item != "" {
+		t.Fatalf("p2c expected empty, actual %s", item)
+	}
+	done()
+
+	lb.Add("A")
+	item = lb.Select()
+	if item != "A" {
+		t.Fatalf("p2c expected A, actual %s", item)
+	}
+
+	nodes := []string{"A", "B", "C", "D"}
+	lb = NewPowerOfTwoChoices(nodes)
+	count := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		item := lb.Select()
+		count[item]++
+	}
+	if count["A"] <= 300 || count["B"] <= 300 || count["C"] <= 300 || count["D"] <= 300 {
+		t.Fatal("p2c wrong")
+	}
+	if count["A"]+count["B"]+count["C"]+count["D"] != 2000 {
+		t.Fatal("p2c wrong")
+	}
+
+	// the most loaded item is never selected
+	busy, doneBusy := lb.Acquire()
+	for i := 0; i < 1000; i++ {
+		item := lb.Select()
+		if item == busy {
+			t.Fatalf("p2c unexpected %s", item)
+		}
+	}
+	doneBusy()
+
+	// pluggable load metric
+	load := map[string]int64{
+		"A": 1,
+		"B": 2,
+		"C": 3,
+		"D": 4,
+	}
+	lb.SetLoadFunc(func(item string) int64 {
+		return load[item]
+	})
+	count = make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		item := lb.Select()
+		count[item]++
+	}
+	if count["D"] != 0 || count["A"] <= count["B"] || count["B"] <= count["C"] {
+		t.Fatal("p2c load func wrong")
+	}
+	lb.SetLoadFunc(nil)
+
+	lb.Add("A")
+	lb.Add("E")
+	all := lb.All().([]string)
+	if strings.Join(all, "") != "ABCDE" {
+		t.Fatal("p2c all() wrong")
+	}
+
+	ok := lb.Remove("C")
+	if ok != true {
+		t.Fatal("p2c remove() wrong")
+	}
+	all = lb.All().([]string)
+	if strings.Join(all, "") != "ABDE" {
+		t.Fatal("p2c all() wrong")
+	}
+
+	ok = lb.Update(map[string]int{"X": 1})
+	if ok != false {
+		t.Fatal("p2c update wrong")
+	}
+
+	lb.RemoveAll()
+	lb.Add("F", 1)
+	all, ok = lb.All().([]string)
+	if !ok || len(all) != 1 {
+		t.Fatal("p2c all() wrong")
+	}
+
+	ok = lb.Update([]string{"X", "Y", "X"})
+	if ok != true {
+		t.Fatal("p2c update wrong")
+	}
+	all = lb.All().([]string)
+	if strings.Join(all, "") != "XY" {
+		t.Fatal("p2c update wrong")
+	}
+}
+
+func TestPowerOfTwoChoices_SelectN(t *testing.T) {
+	load := map[string]int64{
+		"A": 4,
+		"B": 2,
+		"C": 3,
+		"D": 1,
+	}
+	lb := NewPowerOfTwoChoices([]string{"A", "B", "C", "D"})
+	lb.SetLoadFunc(func(item string) int64 {
+		return load[item]
+	})
+	for i := 0; i < 100; i++ {
+		items := lb.SelectN(4)
+		if len(items) != 4 || items[0] == "A" {
+			t.Fatalf("p2c select n wrong: %v", items)
+		}
+		if items[0] != "D" && items[1] != "D" {
+			t.Fatalf("p2c select n wrong: %v", items)
+		}
+	}
+}
+
+func TestPowerOfTwoChoices_C(t *testing.T) {
+	var (
+		a, b, c, d int64
+	)
+	nodes := []string{"A", "B", "C", "D"}
+	lb := NewPowerOfTwoChoices(nodes)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				item, done := lb.Acquire()
+				switch item {
+				case "A":
+					atomic.AddInt64(&a, 1)
+				case "B":
+					atomic.AddInt64(&b, 1)
+				case "C":
+					atomic.AddInt64(&c, 1)
+				case "D":
+					atomic.AddInt64(&d, 1)
+				}
+				done()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt64(&a)+atomic.LoadInt64(&b)+atomic.LoadInt64(&c)+atomic.LoadInt64(&d) != 1000000 {
+		t.Fatal("p2c wrong: sum")
+	}
+	for _, v := range lb.items {
+		if atomic.LoadInt64(&v.inflight) != 0 {
+			t.Fatalf("p2c wrong: %s in-flight %d", v.item, v.inflight)
+		}
+	}
+
+	// a request held in flight steers the selection to the other item
+	lb = NewPowerOfTwoChoices([]string{"A", "B"})
+	held, done := lb.Acquire()
+	var other int64
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if item := lb.Select(); item != held && item != "" {
+					atomic.AddInt64(&other, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	done()
+	if atomic.LoadInt64(&other) != 100000 {
+		t.Fatalf("p2c expected 100000 other than %s, actual %d", held, atomic.LoadInt64(&other))
+	}
+}
@@ -2,42 +2,46 @@ package balancer
 
 import (
 	"sync"
+	"sync/atomic"
 
 	"github.com/fufuok/balancer/utils"
 )
 
 // Random
 type random struct {
-	items []string
-	count uint32
+	items atomic.Pointer[[]string]
 
-	sync.RWMutex
+	sync.Mutex
 }
 
 func NewRandom(items ...[]string) (lb *random) {
 	lb = &random{}
+	lb.items.Store(&[]string{})
 	if len(items) > 0 && len(items[0]) > 0 {
 		lb.Update(items[0])
 	}
 	return
 }
 
+// load gets the snapshot of the items, never modified.
+func (b *random) load() []string {
+	return *b.items.Load()
+}
+
 func (b *random) Add(item string, _ ...int) {
 	b.Lock()
-	b.items = append(b.items, item)
-	b.count++
+	old := b.load()
+	items := make([]string, len(old), len(old)+1)
+	copy(items, old)
+	items = append(items, item)
+	b.items.Store(&items)
 	b.Unlock()
 }
 
 func (b *random) All() interface{} {
-	all := make([]string, b.count)
-
-	b.Lock()
-	for i, v := range b.items {
-		all[i] = v
-	}
-	b.Unlock()
-
+	items := b.load()
+	all := make([]string, len(items))
+	copy(all, items)
 	return all
 }
 
@@ -46,44 +50,100 @@ func (b *random) Name() string {
 }
 
 func (b *random) Select(_ ...string) (item string) {
-	b.RLock()
-	switch b.count {
+	items := b.load()
+	switch len(items) {
 	case 0:
 		item = ""
 	case 1:
-		item = b.items[0]
+		item = items[0]
 	default:
-		item = b.items[utils.FastRandn(b.count)]
+		item = items[utils.FastRandn(uint32(len(items)))]
+	}
+
+	return
+}
+
+func (b *random) SelectExcept(exclude []string, _ ...string) (item string) {
+	skip := excluded(exclude)
+	if skip == nil {
+		return b.Select()
+	}
+
+	items := b.load()
+	count := uint32(len(items))
+	if count == 0 {
+		return
+	}
+	for i := 0; i < 8; i++ {
+		if x := items[utils.FastRandn(count)]; !skip(x) {
+			return x
+		}
 	}
-	b.RUnlock()
 
+	// most of the items are excluded
+	var eligible []string
+	for _, x := range items {
+		if !skip(x) {
+			eligible = append(eligible, x)
+		}
+	}
+	if n := uint32(len(eligible)); n > 0 {
+		item = eligible[utils.FastRandn(n)]
+	}
 	return
 }
 
+// SelectN gets up to n distinct items in random order, an item added more times is more likely to be ahead.
+func (b *random) SelectN(n int, _ ...string) []string {
+	items := b.load()
+	count := uint32(len(items))
+	p := newPicker(n, int(count))
+	if p.full() {
+		return nil
+	}
+	// Fisher-Yates shuffle, only the swapped indexes are recorded
+	swapped := make(map[uint32]uint32)
+	at := func(i uint32) uint32 {
+		if v, ok := swapped[i]; ok {
+			return v
+		}
+		return i
+	}
+	for i := uint32(0); i < count; i++ {
+		j := i + utils.FastRandn(count-i)
+		vi, vj := at(i), at(j)
+		swapped[j] = vi
+		if p.add(items[vj]) {
+			break
+		}
+	}
+	return p.result()
+}
+
 func (b *random) Remove(item string, asClean ...bool) (ok bool) {
 	b.Lock()
 	defer b.Unlock()
 
 	clean := len(asClean) > 0 && asClean[0]
-	for i := uint32(0); i < b.count; i++ {
-		if item == b.items[i] {
-			b.items = append(b.items[:i], b.items[i+1:]...)
-			b.count--
+	old := b.load()
+	items := make([]string, 0, len(old))
+	for _, x := range old {
+		// remove all or remove one
+		if x == item && (clean || !ok) {
 			ok = true
-			// remove all or remove one
-			if !clean {
-				return
-			}
-			i--
+			continue
 		}
+		items = append(items, x)
+	}
+	if ok {
+		b.items.Store(&items)
 	}
 	return
 }
 
 func (b *random) RemoveAll() {
 	b.Lock()
-	b.items = b.items[:0]
-	b.count = 0
+	b.items.Store(&[]string{})
 	b.Unlock()
 }
 
@@ -95,9 +155,11 @@ func (b *random) Update(items interface{}) bool {
 		return false
 	}
 
+	data := make([]string, len(v))
+	copy(data, v)
+
 	b.Lock()
-	b.items = v
-	b.count = uint32(len(v))
+	b.items.Store(&data)
 	b.Unlock()
 
 	return true
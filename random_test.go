@@ -73,6 +73,21 @@ func TestRandom(t *testing.T) {
 	}
 }
 
+func TestRandom_SelectN(t *testing.T) {
+	lb := NewRandom([]string{"A", "B", "C", "D", "A", "A"})
+	count := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		items := lb.SelectN(2)
+		if len(items) != 2 || items[0] == items[1] {
+			t.Fatalf("r select n wrong: %v", items)
+		}
+		count[items[0]]++
+	}
+	if count["A"] <= 800 || count["B"] <= 200 || count["C"] <= 200 || count["D"] <= 200 {
+		t.Fatalf("r select n wrong: %v", count)
+	}
+}
+
 func TestRandom_C(t *testing.T) {
 	var (
 		a, b, c, d int64
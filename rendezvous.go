@@ -0,0 +1,241 @@
+package balancer
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/fufuok/balancer/utils"
+)
+
+// Rendezvous hashing (highest random weight)
+// Each item is scored by the hash of the key and the item, weighted by the logarithmic method.
+// Ref: https://en.wikipedia.org/wiki/Rendezvous_hashing#Weighted_rendezvous_hash
+type rendezvous struct {
+	items []*hrwItem
+	count int
+	all   map[string]int
+
+	sync.RWMutex
+}
+
+type hrwItem struct {
+	item   string
+	weight float64
+}
+
+type hrwScore struct {
+	item  string
+	score float64
+}
+
+func NewRendezvous(items ...map[string]int) (lb *rendezvous) {
+	if len(items) > 0 && len(items[0]) > 0 {
+		lb = &rendezvous{}
+		lb.Update(items[0])
+		return
+	}
+	return &rendezvous{
+		all: make(map[string]int),
+	}
+}
+
+func (b *rendezvous) Add(item string, weight ...int) {
+	w := 1
+	if len(weight) > 0 {
+		w = weight[0]
+	}
+
+	b.Lock()
+	b.remove(item)
+	b.all[item] = w
+	if w > 0 {
+		b.items = append(b.items, &hrwItem{
+			item:   item,
+			weight: float64(w),
+		})
+		b.count++
+	}
+	b.Unlock()
+}
+
+// SetWeight sets the weight of the item, the keys move only to or from the item.
+func (b *rendezvous) SetWeight(item string, weight int) {
+	b.Lock()
+	defer b.Unlock()
+
+	if weight > 0 {
+		for _, c := range b.items {
+			if item == c.item {
+				c.weight = float64(weight)
+				b.all[item] = weight
+				return
+			}
+		}
+	}
+	b.remove(item)
+	b.all[item] = weight
+	if weight > 0 {
+		b.items = append(b.items, &hrwItem{
+			item:   item,
+			weight: float64(weight),
+		})
+		b.count++
+	}
+}
+
+func (b *rendezvous) All() interface{} {
+	all := make(map[string]int)
+
+	b.RLock()
+	for k, v := range b.all {
+		all[k] = v
+	}
+	b.RUnlock()
+
+	return all
+}
+
+func (b *rendezvous) Name() string {
+	return "Rendezvous"
+}
+
+func (b *rendezvous) Select(key ...string) (item string) {
+	b.RLock()
+	switch b.count {
+	case 0:
+		item = ""
+	case 1:
+		item = b.items[0].item
+	default:
+		best := math.Inf(-1)
+		for _, c := range b.items {
+			if score := c.score(key); score > best {
+				best = score
+				item = c.item
+			}
+		}
+	}
+	b.RUnlock()
+
+	return
+}
+
+// SelectExcept gets the item of the highest score for the key other than the excluded items.
+func (b *rendezvous) SelectExcept(exclude []string, key ...string) (item string) {
+	skip := excluded(exclude)
+	if skip == nil {
+		return b.Select(key...)
+	}
+
+	b.RLock()
+	best := math.Inf(-1)
+	for _, c := range b.items {
+		if skip(c.item) {
+			continue
+		}
+		if score := c.score(key); score > best {
+			best = score
+			item = c.item
+		}
+	}
+	b.RUnlock()
+
+	return
+}
+
+// SelectN gets up to n distinct items in the order of preference for the key.
+func (b *rendezvous) SelectN(n int, key ...string) []string {
+	b.RLock()
+	scores := make([]hrwScore, b.count)
+	for i, c := range b.items {
+		scores[i] = hrwScore{
+			item:  c.item,
+			score: c.score(key),
+		}
+	}
+	b.RUnlock()
+
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i].score > scores[j].score
+	})
+
+	if n > len(scores) {
+		n = len(scores)
+	}
+	if n <= 0 {
+		return nil
+	}
+	items := make([]string, n)
+	for i := range items {
+		items[i] = scores[i].item
+	}
+	return items
+}
+
+// score -weight / ln(h), h is the hash of the key and the item mapped to (0, 1).
+func (c *hrwItem) score(key []string) float64 {
+	hash := utils.Fmix64(utils.HashString(append(key[:len(key):len(key)], c.item)...))
+	h := (float64(hash>>11) + 0.5) / (1 << 53)
+	return -c.weight / math.Log(h)
+}
+
+func (b *rendezvous) Remove(item string, _ ...bool) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.remove(item)
+}
+
+func (b *rendezvous) remove(item string) (ok bool) {
+	if _, ok = b.all[item]; !ok {
+		return
+	}
+	delete(b.all, item)
+	for i := 0; i < b.count; i++ {
+		if item == b.items[i].item {
+			b.items = append(b.items[:i], b.items[i+1:]...)
+			b.count--
+			break
+		}
+	}
+	return
+}
+
+func (b *rendezvous) RemoveAll() {
+	b.Lock()
+	b.items = b.items[:0]
+	b.count = 0
+	b.all = make(map[string]int)
+	b.Unlock()
+}
+
+func (b *rendezvous) Reset() {}
+
+func (b *rendezvous) Update(items interface{}) bool {
+	v, ok := items.(map[string]int)
+	if !ok {
+		return false
+	}
+
+	var data []*hrwItem
+	all := make(map[string]int, len(v))
+	for item, weight := range v {
+		all[item] = weight
+		// Discard items with a weight less than 1
+		if weight > 0 {
+			data = append(data, &hrwItem{
+				item:   item,
+				weight: float64(weight),
+			})
+		}
+	}
+
+	b.Lock()
+	b.items = data
+	b.count = len(data)
+	b.all = all
+	b.Unlock()
+
+	return true
+}
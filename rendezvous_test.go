@@ -0,0 +1,154 @@
+package balancer
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRendezvous(t *testing.T) {
+	lb := NewRendezvous()
+	item := lb.Select()
+	if item != "" {
+		t.Fatalf("hrw expected empty, actual %s", item)
+	}
+	if items := lb.SelectN(3); len(items) != 0 {
+		t.Fatalf("hrw expected empty, actual %v", items)
+	}
+
+	lb.Add("A", 0)
+	item = lb.Select()
+	if item != "" {
+		t.Fatalf("hrw expected empty, actual %s", item)
+	}
+	lb.Add("B")
+	item = lb.Select("192.168.1.100")
+	if item != "B" {
+		t.Fatalf("hrw expected B, actual %s", item)
+	}
+
+	nodes := map[string]int{
+		"A": 0,
+		"B": 1,
+		"C": 7,
+		"D": 2,
+	}
+	lb = NewRendezvous(nodes)
+	count := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		item := lb.Select(strconv.Itoa(i))
+		count[item]++
+	}
+	if count["A"] != 0 || count["B"] <= 800 || count["C"] <= 6500 || count["D"] <= 1700 {
+		t.Fatalf("hrw wrong: %v", count)
+	}
+
+	// stable ordered preference list per key
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		items := lb.SelectN(2, key)
+		if len(items) != 2 || items[0] != lb.Select(key) || items[0] == items[1] {
+			t.Fatalf("hrw select n wrong: %v", items)
+		}
+		if strings.Join(lb.SelectN(5, key), "") != strings.Join(lb.SelectN(3, key), "") {
+			t.Fatal("hrw select n wrong")
+		}
+	}
+	if items := lb.SelectN(0, "192.168.1.100"); len(items) != 0 {
+		t.Fatalf("hrw expected empty, actual %v", items)
+	}
+
+	// only the keys of the removed item are moved, to their second choice
+	before := make(map[string][]string)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		before[key] = lb.SelectN(2, key)
+	}
+	ok := lb.Remove("C")
+	if ok != true {
+		t.Fatal("hrw remove() wrong")
+	}
+	ok = lb.Remove("C")
+	if ok != false {
+		t.Fatal("hrw remove() wrong")
+	}
+	for key, v := range before {
+		item := lb.Select(key)
+		if (v[0] == "C" && item != v[1]) || (v[0] != "C" && item != v[0]) {
+			t.Fatalf("hrw %s expected %v, actual %s", key, v, item)
+		}
+	}
+
+	ok = lb.Update([]string{"X"})
+	if ok != false {
+		t.Fatal("hrw update wrong")
+	}
+
+	lb.RemoveAll()
+	lb.Add("F", 2)
+	lb.Add("F", 1)
+	all, ok := lb.All().(map[string]int)
+	if !ok || len(all) != 1 || all["F"] != 1 {
+		t.Fatal("hrw all() wrong")
+	}
+
+	nodes = map[string]int{
+		"X": 0,
+		"Y": 1,
+	}
+	ok = lb.Update(nodes)
+	if ok != true {
+		t.Fatal("hrw update wrong")
+	}
+	item = lb.Select("192.168.1.100")
+	if item != "Y" {
+		t.Fatal("hrw update wrong")
+	}
+}
+
+func TestRendezvous_Update(t *testing.T) {
+	nodes := map[string]int{"A": 1, "B": 1}
+	lb := NewRendezvous(nodes)
+
+	// the map of the caller is not changed
+	lb.Add("X", 3)
+	lb.Remove("A")
+	if len(nodes) != 2 || nodes["A"] != 1 || nodes["B"] != 1 {
+		t.Fatalf("hrw update wrong: %v", nodes)
+	}
+	if all := lb.All().(map[string]int); len(all) != 2 || all["X"] != 3 {
+		t.Fatalf("hrw all wrong: %v", all)
+	}
+}
+
+func TestRendezvous_C(t *testing.T) {
+	var c int64
+	nodes := map[string]int{
+		"A": 1,
+		"B": 1,
+		"C": 1,
+		"D": 1,
+	}
+	lb := NewRendezvous(nodes)
+	expected := lb.Select("192.168.1.7")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				if lb.Select("192.168.1.7") == expected {
+					atomic.AddInt64(&c, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt64(&c) != 1000000 {
+		t.Fatalf("hrw expected %s == 1000000, actual %d", expected, atomic.LoadInt64(&c))
+	}
+}
@@ -0,0 +1,236 @@
+package balancer
+
+import (
+	"crypto/md5"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/fufuok/balancer/utils"
+)
+
+// DefaultVirtualNodes is the default number of virtual nodes per item of RingHash, the same as libketama.
+const DefaultVirtualNodes = 160
+
+// Ketama consistent hashing
+// Key to item assignments are compatible with the libketama clients, e.g. memcached, twemproxy.
+// Ref: https://github.com/RJ/ketama/blob/master/libketama/ketama.c
+type ringHash struct {
+	points   []ringPoint
+	count    int
+	replicas int
+	all      map[string]int
+
+	sync.RWMutex
+}
+
+type ringPoint struct {
+	hash uint32
+	item string
+}
+
+func NewRingHash(items ...map[string]int) (lb *ringHash) {
+	lb = &ringHash{
+		replicas: DefaultVirtualNodes,
+		all:      make(map[string]int),
+	}
+	if len(items) > 0 && len(items[0]) > 0 {
+		lb.Update(items[0])
+	}
+	return
+}
+
+// SetVirtualNodes sets the number of virtual nodes per item of the average weight, default: 160.
+// It is rounded down to a multiple of 4, since each md5 digest gives 4 points on the ring.
+func (b *ringHash) SetVirtualNodes(n int) {
+	if n < 4 {
+		n = DefaultVirtualNodes
+	}
+
+	b.Lock()
+	b.replicas = n
+	b.build()
+	b.Unlock()
+}
+
+func (b *ringHash) Add(item string, weight ...int) {
+	w := 1
+	if len(weight) > 0 {
+		w = weight[0]
+	}
+
+	b.Lock()
+	b.all[item] = w
+	b.build()
+	b.Unlock()
+}
+
+func (b *ringHash) All() interface{} {
+	all := make(map[string]int)
+
+	b.RLock()
+	for k, v := range b.all {
+		all[k] = v
+	}
+	b.RUnlock()
+
+	return all
+}
+
+func (b *ringHash) Name() string {
+	return "RingHash"
+}
+
+func (b *ringHash) Select(key ...string) (item string) {
+	b.RLock()
+	switch b.count {
+	case 0:
+		item = ""
+	default:
+		item = b.points[b.search(key)].item
+	}
+	b.RUnlock()
+
+	return
+}
+
+// SelectN gets up to n distinct items clockwise from the hash of the key.
+func (b *ringHash) SelectN(n int, key ...string) []string {
+	b.RLock()
+	defer b.RUnlock()
+
+	p := newPicker(n, len(b.all))
+	if p.full() || b.count == 0 {
+		return nil
+	}
+	start := b.search(key)
+	for i := 0; i < b.count; i++ {
+		if p.add(b.points[(start+i)%b.count].item) {
+			break
+		}
+	}
+	return p.result()
+}
+
+// SelectExcept gets the first item not excluded clockwise from the hash of the key.
+func (b *ringHash) SelectExcept(exclude []string, key ...string) string {
+	skip := excluded(exclude)
+	if skip == nil {
+		return b.Select(key...)
+	}
+
+	b.RLock()
+	defer b.RUnlock()
+
+	if b.count == 0 {
+		return ""
+	}
+	start := b.search(key)
+	for i := 0; i < b.count; i++ {
+		if x := b.points[(start+i)%b.count].item; !skip(x) {
+			return x
+		}
+	}
+	return ""
+}
+
+// search returns the index of the first point clockwise from the hash of the key.
+func (b *ringHash) search(key []string) int {
+	hash := ketamaHash(utils.AddString(key...))
+	i := sort.Search(b.count, func(i int) bool {
+		return b.points[i].hash >= hash
+	})
+	if i == b.count {
+		i = 0
+	}
+	return i
+}
+
+func (b *ringHash) Remove(item string, _ ...bool) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.all[item]; !ok {
+		return false
+	}
+	delete(b.all, item)
+	b.build()
+	return true
+}
+
+func (b *ringHash) RemoveAll() {
+	b.Lock()
+	b.all = make(map[string]int)
+	b.build()
+	b.Unlock()
+}
+
+func (b *ringHash) Reset() {}
+
+func (b *ringHash) Update(items interface{}) bool {
+	v, ok := items.(map[string]int)
+	if !ok {
+		return false
+	}
+
+	all := make(map[string]int, len(v))
+	for item, weight := range v {
+		all[item] = weight
+	}
+
+	b.Lock()
+	b.all = all
+	b.build()
+	b.Unlock()
+
+	return true
+}
+
+// build creates the continuum the same way as libketama: an item gets
+// floor(weight / total * replicas/4 * number_of_items) md5 digests of "item-k".
+func (b *ringHash) build() {
+	n, total := 0, 0
+	for _, weight := range b.all {
+		if weight > 0 {
+			n++
+			total += weight
+		}
+	}
+
+	points := make([]ringPoint, 0, n*b.replicas)
+	for item, weight := range b.all {
+		if weight <= 0 {
+			continue
+		}
+		// float32 arithmetic on purpose, to get the same number of points as libketama
+		pct := float32(weight) / float32(total)
+		ks := int(math.Floor(float64(float32(float64(pct) * float64(b.replicas/4) * float64(n)))))
+		for k := 0; k < ks; k++ {
+			digest := md5.Sum(utils.S2B(item + "-" + strconv.Itoa(k)))
+			for h := 0; h < 4; h++ {
+				points = append(points, ringPoint{
+					hash: uint32(digest[3+h*4])<<24 | uint32(digest[2+h*4])<<16 |
+						uint32(digest[1+h*4])<<8 | uint32(digest[h*4]),
+					item: item,
+				})
+			}
+		}
+	}
+
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].hash == points[j].hash {
+			return points[i].item < points[j].item
+		}
+		return points[i].hash < points[j].hash
+	})
+
+	b.points = points
+	b.count = len(points)
+}
+
+// ketamaHash the first 4 bytes of the md5 digest in little-endian order.
+func ketamaHash(key string) uint32 {
+	digest := md5.Sum(utils.S2B(key))
+	return uint32(digest[3])<<24 | uint32(digest[2])<<16 | uint32(digest[1])<<8 | uint32(digest[0])
+}
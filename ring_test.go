@@ -0,0 +1,209 @@
+package balancer
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRingHash(t *testing.T) {
+	lb := NewRingHash()
+	item := lb.Select()
+	if item != "" {
+		t.Fatalf("ring expected empty, actual %s", item)
+	}
+
+	lb.Add("A", 0)
+	item = lb.Select()
+	if item != "" {
+		t.Fatalf("ring expected empty, actual %s", item)
+	}
+	lb.Add("B")
+	item = lb.Select("192.168.1.100")
+	if item != "B" {
+		t.Fatalf("ring expected B, actual %s", item)
+	}
+	if lb.count != 160 {
+		t.Fatalf("ring expected 160 points, actual %d", lb.count)
+	}
+
+	// the same assignments as libketama
+	nodes := map[string]int{
+		"10.0.1.1:11211": 600,
+		"10.0.1.2:11211": 300,
+		"10.0.1.3:11211": 200,
+	}
+	lb = NewRingHash(nodes)
+	if lb.count != 472 {
+		t.Fatalf("ring expected 472 points, actual %d", lb.count)
+	}
+	expected := map[string]string{
+		"foo":           "10.0.1.2:11211",
+		"bar":           "10.0.1.1:11211",
+		"baz":           "10.0.1.2:11211",
+		"192.168.1.100": "10.0.1.1:11211",
+		"memcached":     "10.0.1.2:11211",
+		"user:1000":     "10.0.1.1:11211",
+		"a":             "10.0.1.3:11211",
+		"b":             "10.0.1.1:11211",
+	}
+	for key, v := range expected {
+		item := lb.Select(key)
+		if item != v {
+			t.Fatalf("ring %s expected %s, actual %s", key, v, item)
+		}
+	}
+	item = lb.Select("user:", "1000")
+	if item != "10.0.1.1:11211" {
+		t.Fatalf("ring expected 10.0.1.1:11211, actual %s", item)
+	}
+
+	// keys are distributed by weight
+	count := make(map[string]int)
+	for i := 0; i < 11000; i++ {
+		item := lb.Select(strconv.Itoa(i))
+		count[item]++
+	}
+	if count["10.0.1.1:11211"] <= 5000 || count["10.0.1.2:11211"] <= 2500 || count["10.0.1.3:11211"] <= 1500 {
+		t.Fatalf("ring wrong: %v", count)
+	}
+
+	// only the keys of the removed item are moved
+	lb.Update(map[string]int{
+		"10.0.1.1:11211": 1,
+		"10.0.1.2:11211": 1,
+		"10.0.1.3:11211": 1,
+	})
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		before[key] = lb.Select(key)
+	}
+	ok := lb.Remove("10.0.1.3:11211")
+	if ok != true {
+		t.Fatal("ring remove() wrong")
+	}
+	ok = lb.Remove("10.0.1.3:11211")
+	if ok != false {
+		t.Fatal("ring remove() wrong")
+	}
+	for key, v := range before {
+		item := lb.Select(key)
+		if v != "10.0.1.3:11211" && item != v {
+			t.Fatalf("ring %s expected %s, actual %s", key, v, item)
+		}
+	}
+
+	lb.SetVirtualNodes(40)
+	if lb.count != 80 {
+		t.Fatalf("ring expected 80 points, actual %d", lb.count)
+	}
+	lb.SetVirtualNodes(0)
+	if lb.count != 320 {
+		t.Fatalf("ring expected 320 points, actual %d", lb.count)
+	}
+
+	ok = lb.Update([]string{"X"})
+	if ok != false {
+		t.Fatal("ring update wrong")
+	}
+
+	lb.RemoveAll()
+	lb.Add("F", 2)
+	lb.Add("F", 1)
+	all, ok := lb.All().(map[string]int)
+	if !ok || all["F"] != 1 {
+		t.Fatal("ring all() wrong")
+	}
+
+	nodes = map[string]int{
+		"X": 0,
+		"Y": 1,
+	}
+	ok = lb.Update(nodes)
+	if ok != true {
+		t.Fatal("ring update wrong")
+	}
+	item = lb.Select("192.168.1.100")
+	if item != "Y" {
+		t.Fatal("ring update wrong")
+	}
+}
+
+func TestRingHash_SelectN(t *testing.T) {
+	lb := NewRingHash(map[string]int{
+		"A": 1,
+		"B": 1,
+		"C": 1,
+		"D": 1,
+	})
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		items := lb.SelectN(2, key)
+		if len(items) != 2 || items[0] != lb.Select(key) || items[0] == items[1] {
+			t.Fatalf("ring select n wrong: %v", items)
+		}
+	}
+
+	// the second item takes over the keys of the removed first one
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		if items := lb.SelectN(2, key); items[0] == "A" {
+			before[key] = items[1]
+		}
+	}
+	lb.Remove("A")
+	for key, v := range before {
+		item := lb.Select(key)
+		if item != v {
+			t.Fatalf("ring %s expected %s, actual %s", key, v, item)
+		}
+	}
+}
+
+func TestRingHash_Update(t *testing.T) {
+	nodes := map[string]int{"A": 1, "B": 1}
+	lb := NewRingHash(nodes)
+
+	// the map of the caller is not changed
+	lb.Add("X", 3)
+	lb.Remove("A")
+	if len(nodes) != 2 || nodes["A"] != 1 || nodes["B"] != 1 {
+		t.Fatalf("ring update wrong: %v", nodes)
+	}
+	if all := lb.All().(map[string]int); len(all) != 2 || all["X"] != 3 {
+		t.Fatalf("ring all wrong: %v", all)
+	}
+}
+
+func TestRingHash_C(t *testing.T) {
+	var c int64
+	nodes := map[string]int{
+		"A": 1,
+		"B": 1,
+		"C": 1,
+		"D": 1,
+	}
+	lb := NewRingHash(nodes)
+	expected := lb.Select("192.168.1.7")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				if lb.Select("192.168.1.7") == expected {
+					atomic.AddInt64(&c, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt64(&c) != 1000000 {
+		t.Fatalf("ring expected %s == 1000000, actual %d", expected, atomic.LoadInt64(&c))
+	}
+}
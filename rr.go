@@ -2,41 +2,56 @@ package balancer
 
 import (
 	"sync"
+	"sync/atomic"
 )
 
 // RoundRobin
 type rr struct {
-	items   []string
-	count   int
-	current int
+	items atomic.Pointer[[]string]
+
+	// the count of the items selected, the next item is at current % len(items)
+	current uint64
 
 	sync.Mutex
 }
 
 func NewRoundRobin(items ...[]string) (lb *rr) {
 	lb = &rr{}
+	lb.items.Store(&[]string{})
 	if len(items) > 0 && len(items[0]) > 0 {
 		lb.Update(items[0])
 	}
 	return
 }
 
-func (b *rr) Add(item string, _ ...int) {
-	b.Lock()
-	b.items = append(b.items, item)
-	b.count++
-	b.Unlock()
+// load gets the snapshot of the items, never modified.
+func (b *rr) load() []string {
+	return *b.items.Load()
 }
 
-func (b *rr) All() interface{} {
-	all := make([]string, b.count)
+// store publishes the items, keeping the position of the next item. The lock must be held.
+func (b *rr) store(items []string) {
+	pos := uint64(0)
+	if n := uint64(len(b.load())); n > 0 {
+		pos = atomic.LoadUint64(&b.current) % n
+	}
+	b.items.Store(&items)
+	atomic.StoreUint64(&b.current, pos)
+}
 
+func (b *rr) Add(item string, _ ...int) {
 	b.Lock()
-	for i, v := range b.items {
-		all[i] = v
-	}
+	old := b.load()
+	items := make([]string, len(old), len(old)+1)
+	copy(items, old)
+	b.store(append(items, item))
 	b.Unlock()
+}
 
+func (b *rr) All() interface{} {
+	items := b.load()
+	all := make([]string, len(items))
+	copy(all, items)
 	return all
 }
 
@@ -45,53 +60,93 @@ func (b *rr) Name() string {
 }
 
 func (b *rr) Select(_ ...string) (item string) {
-	b.Lock()
-	switch b.count {
+	items := b.load()
+	switch len(items) {
 	case 0:
 		item = ""
 	case 1:
-		item = b.items[0]
+		item = items[0]
 	default:
-		item = b.items[b.current]
-		b.current = (b.current + 1) % b.count
+		k := atomic.AddUint64(&b.current, 1) - 1
+		item = items[k%uint64(len(items))]
+	}
+
+	return
+}
+
+func (b *rr) SelectExcept(exclude []string, _ ...string) (item string) {
+	skip := excluded(exclude)
+	if skip == nil {
+		return b.Select()
 	}
-	b.Unlock()
 
+	items := b.load()
+	n := uint64(len(items))
+	if n == 0 {
+		return
+	}
+	k := atomic.AddUint64(&b.current, 1) - 1
+	for i := uint64(0); i < n; i++ {
+		if x := items[(k+i)%n]; !skip(x) {
+			// the next one is after the selected item, unless others selected meanwhile
+			if i > 0 {
+				atomic.CompareAndSwapUint64(&b.current, k+1, k+i+1)
+			}
+			return x
+		}
+	}
 	return
 }
 
+func (b *rr) SelectN(n int, _ ...string) []string {
+	items := b.load()
+	count := uint64(len(items))
+	p := newPicker(n, int(count))
+	if p.full() {
+		return nil
+	}
+	start := uint64(0)
+	if count > 1 {
+		start = atomic.AddUint64(&b.current, 1) - 1
+	}
+	for i := uint64(0); i < count; i++ {
+		if p.add(items[(start+i)%count]) {
+			break
+		}
+	}
+	return p.result()
+}
+
 func (b *rr) Remove(item string, asClean ...bool) (ok bool) {
 	b.Lock()
 	defer b.Unlock()
 
 	clean := len(asClean) > 0 && asClean[0]
-	for i := 0; i < b.count; i++ {
-		if item == b.items[i] {
-			b.items = append(b.items[:i], b.items[i+1:]...)
-			b.count--
+	old := b.load()
+	items := make([]string, 0, len(old))
+	for _, x := range old {
+		// remove all or remove one
+		if x == item && (clean || !ok) {
 			ok = true
-			// remove all or remove one
-			if !clean {
-				return
-			}
-			i--
+			continue
 		}
+		items = append(items, x)
+	}
+	if ok {
+		b.store(items)
 	}
 	return
 }
 
 func (b *rr) RemoveAll() {
 	b.Lock()
-	b.items = b.items[:0]
-	b.count = 0
-	b.current = 0
+	b.items.Store(&[]string{})
+	atomic.StoreUint64(&b.current, 0)
 	b.Unlock()
 }
 
 func (b *rr) Reset() {
-	b.Lock()
-	b.current = 0
-	b.Unlock()
+	atomic.StoreUint64(&b.current, 0)
 }
 
 func (b *rr) Update(items interface{}) bool {
@@ -100,11 +155,29 @@ func (b *rr) Update(items interface{}) bool {
 		return false
 	}
 
+	data := make([]string, len(v))
+	copy(data, v)
+
 	b.Lock()
-	b.items = v
-	b.count = len(v)
-	b.current = 0
-	b.Unlock()
+	defer b.Unlock()
+
+	// the rotation goes on from the next retained item
+	pos := 0
+	if old := b.load(); len(old) > 0 && len(data) > 0 {
+		index := make(map[string]int, len(data))
+		for i := len(data) - 1; i >= 0; i-- {
+			index[data[i]] = i
+		}
+		k := int(atomic.LoadUint64(&b.current) % uint64(len(old)))
+		for i := 0; i < len(old); i++ {
+			if j, ok := index[old[(k+i)%len(old)]]; ok {
+				pos = j
+				break
+			}
+		}
+	}
+	b.items.Store(&data)
+	atomic.StoreUint64(&b.current, uint64(pos))
 
 	return true
 }
@@ -114,6 +114,63 @@ func TestRoundRobin(t *testing.T) {
 	}
 }
 
+func TestRoundRobin_SelectN(t *testing.T) {
+	lb := NewRoundRobin([]string{"A", "B", "A", "C", "D"})
+	items := lb.SelectN(3)
+	if strings.Join(items, "") != "ABC" {
+		t.Fatalf("rr expected ABC, actual %v", items)
+	}
+	item := lb.Select()
+	if item != "B" {
+		t.Fatalf("rr expected B, actual %s", item)
+	}
+	items = lb.SelectN(10)
+	if strings.Join(items, "") != "ACDB" {
+		t.Fatalf("rr expected ACDB, actual %v", items)
+	}
+	item = lb.Select()
+	if item != "C" {
+		t.Fatalf("rr expected C, actual %s", item)
+	}
+}
+
+func TestRoundRobin_SelectExcept(t *testing.T) {
+	lb := NewRoundRobin([]string{"A", "B", "C", "D"})
+	items := ""
+	for i := 0; i < 4; i++ {
+		items += lb.SelectExcept([]string{"B"})
+	}
+	if items != "ACDA" {
+		t.Fatalf("rr expected ACDA, actual %s", items)
+	}
+	item := lb.Select()
+	if item != "B" {
+		t.Fatalf("rr expected B, actual %s", item)
+	}
+}
+
+func TestRoundRobin_Update(t *testing.T) {
+	lb := NewRoundRobin([]string{"A", "B", "C"})
+	lb.Select()
+	lb.Select()
+
+	// goes on from C
+	lb.Update([]string{"D", "C", "A"})
+	for _, v := range []string{"C", "A", "D", "C"} {
+		if item := lb.Select(); item != v {
+			t.Fatalf("rr expected %s, actual %s", v, item)
+		}
+	}
+
+	// goes on from the next retained item of A
+	lb.Update([]string{"B", "D"})
+	for _, v := range []string{"D", "B", "D"} {
+		if item := lb.Select(); item != v {
+			t.Fatalf("rr expected %s, actual %s", v, item)
+		}
+	}
+}
+
 func TestRoundRobin_C(t *testing.T) {
 	var (
 		a, b, c, d int64
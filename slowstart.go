@@ -0,0 +1,79 @@
+package balancer
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultSlowStartMinWeight is the min percent of the weight of a new item in the slow start window.
+	DefaultSlowStartMinWeight = 0.1
+
+	// slowStartScale scales up the integer weights, so that the small weights ramp up smoothly.
+	slowStartScale = 100
+
+	// slowStartSteps is the number of times the weights are recomputed in the window by WeightedRoundRobin.
+	slowStartSteps = 100
+)
+
+// slowStart ramps up the weights of the new items of WeightedRoundRobin/SmoothWeightedRoundRobin/WeightedRand,
+// the weight at t of the window is: weight * max(DefaultSlowStartMinWeight, (t/window)^(1/aggression)).
+// Ref: https://www.envoyproxy.io/docs/envoy/latest/intro/arch_overview/upstream/load_balancing/slow_start
+type slowStart struct {
+	window     int64
+	aggression float64
+	until      int64
+}
+
+func (s *slowStart) set(window time.Duration, aggression ...float64) {
+	if window < 0 {
+		window = 0
+	}
+	s.window = int64(window)
+	s.aggression = 1
+	if len(aggression) > 0 && aggression[0] > 0 {
+		s.aggression = aggression[0]
+	}
+}
+
+// begin starts the ramp of a new item, returns the start time, 0 if the slow start is disabled.
+func (s *slowStart) begin() int64 {
+	if s.window <= 0 {
+		return 0
+	}
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&s.until, now+s.window)
+	return now
+}
+
+// now returns the current time if any item is ramping up, otherwise 0.
+func (s *slowStart) now() int64 {
+	until := atomic.LoadInt64(&s.until)
+	if until == 0 {
+		return 0
+	}
+	now := time.Now().UnixNano()
+	if now >= until {
+		atomic.CompareAndSwapInt64(&s.until, until, 0)
+		return 0
+	}
+	return now
+}
+
+// step returns the interval of the recomputation of the weights.
+func (s *slowStart) step() int64 {
+	if step := s.window / slowStartSteps; step > 0 {
+		return step
+	}
+	return 1
+}
+
+// factor returns the percent of the weight of an item started at start, 1 at the end of the ramp.
+func (s *slowStart) factor(start, now int64) float64 {
+	if start == 0 || now == 0 || s.window <= 0 || now-start >= s.window {
+		return 1
+	}
+	f := math.Pow(float64(now-start)/float64(s.window), 1/s.aggression)
+	return math.Max(f, DefaultSlowStartMinWeight)
+}
@@ -0,0 +1,48 @@
+package balancer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlowStart(t *testing.T) {
+	var s slowStart
+	if s.begin() != 0 || s.now() != 0 {
+		t.Fatal("slow start disabled wrong")
+	}
+
+	s.set(100 * time.Millisecond)
+	start := s.begin()
+	if start == 0 || s.now() == 0 {
+		t.Fatal("slow start begin wrong")
+	}
+	window := int64(100 * time.Millisecond)
+	for _, v := range []struct {
+		elapsed int64
+		f       float64
+	}{
+		{0, DefaultSlowStartMinWeight},
+		{window / 20, DefaultSlowStartMinWeight},
+		{window / 4, 0.25},
+		{window / 2, 0.5},
+		{window, 1},
+		{2 * window, 1},
+	} {
+		if f := s.factor(start, start+v.elapsed); f != v.f {
+			t.Fatalf("slow start factor expected %v, actual %v", v.f, f)
+		}
+	}
+	if s.factor(0, start) != 1 || s.factor(start, 0) != 1 {
+		t.Fatal("slow start factor wrong")
+	}
+
+	s.set(100*time.Millisecond, 2)
+	if f := s.factor(start, start+window/4); f != 0.5 {
+		t.Fatalf("slow start aggression expected 0.5, actual %v", f)
+	}
+
+	time.Sleep(110 * time.Millisecond)
+	if s.now() != 0 || s.until != 0 {
+		t.Fatal("slow start end wrong")
+	}
+}
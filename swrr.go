@@ -1,7 +1,9 @@
 package balancer
 
 import (
+	"sort"
 	"sync"
+	"time"
 )
 
 // Smooth weighted round-robin balancing
@@ -10,6 +12,8 @@ type swrr struct {
 	items []*swrrItem
 	count int
 	all   map[string]int
+	ss    slowStart
+	scale int
 
 	sync.Mutex
 }
@@ -18,19 +22,55 @@ type swrrItem struct {
 	item          string
 	weight        int
 	currentWeight int
+	start         int64
 }
 
 func NewSmoothWeightedRoundRobin(items ...map[string]int) (lb *swrr) {
 	if len(items) > 0 && len(items[0]) > 0 {
-		lb = &swrr{}
+		lb = &swrr{scale: 1}
 		lb.Update(items[0])
 		return
 	}
 	return &swrr{
-		all: make(map[string]int),
+		all:   make(map[string]int),
+		scale: 1,
 	}
 }
 
+// SetSlowStart ramps up the weights of the items added later from 10% to 100% in the window, 0 disables it.
+// aggression 1 (default) ramps up linearly, the greater the faster at first.
+func (b *swrr) SetSlowStart(window time.Duration, aggression ...float64) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.ss.set(window, aggression...)
+	scale := 1
+	if b.ss.window > 0 {
+		scale = slowStartScale
+	}
+	for _, c := range b.items {
+		c.currentWeight = c.currentWeight * scale / b.scale
+	}
+	b.scale = scale
+}
+
+// weightOf gets the current weight of the item in the scale of the slow start.
+func (b *swrr) weightOf(c *swrrItem, now int64) int {
+	w := c.weight * b.scale
+	if c.start == 0 || now == 0 || w <= 0 {
+		return w
+	}
+	f := b.ss.factor(c.start, now)
+	if f >= 1 {
+		c.start = 0
+		return w
+	}
+	if w = int(float64(w) * f); w < 1 {
+		w = 1
+	}
+	return w
+}
+
 func (b *swrr) Add(item string, weight ...int) {
 	w := 1
 	if len(weight) > 0 {
@@ -43,15 +83,34 @@ func (b *swrr) Add(item string, weight ...int) {
 }
 
 func (b *swrr) add(item string, weight int) {
-	b.remove(item)
-	b.items = append(b.items, &swrrItem{
+	c := &swrrItem{
 		item:   item,
 		weight: weight,
-	})
+	}
+	if i := b.indexOf(item); i >= 0 {
+		c.start = b.items[i].start
+	} else {
+		c.start = b.ss.begin()
+	}
+	b.remove(item)
+	b.items = append(b.items, c)
 	b.count++
 	b.all[item] = weight
 }
 
+// SetWeight sets the weight of the item in place, keeping the current weights of the items.
+func (b *swrr) SetWeight(item string, weight int) {
+	b.Lock()
+	defer b.Unlock()
+
+	if i := b.indexOf(item); i >= 0 {
+		b.items[i].weight = weight
+		b.all[item] = weight
+		return
+	}
+	b.add(item, weight)
+}
+
 func (b *swrr) All() interface{} {
 	all := make(map[string]int)
 
@@ -78,14 +137,53 @@ func (b *swrr) Select(_ ...string) (item string) {
 			item = b.items[0].item
 		}
 	default:
-		item = b.chooseNext().item
+		// all weights are zero if the choice is of zero weight
+		if c := b.chooseNext(nil); c != nil && c.weight > 0 {
+			item = c.item
+		}
 	}
 	b.Unlock()
 
 	return
 }
 
-func (b *swrr) chooseNext() (choice *swrrItem) {
+// chooseNext runs a round among the items not skipped.
+func (b *swrr) chooseNext(skip func(string) bool) (choice *swrrItem) {
+	now := b.ss.now()
+	if now == 0 && b.scale == 1 && skip == nil {
+		return b.chooseNextAll()
+	}
+
+	total := 0
+	for i := range b.items {
+		c := b.items[i]
+		if c == nil {
+			return nil
+		}
+		if skip != nil && skip(c.item) {
+			continue
+		}
+
+		w := b.weightOf(c, now)
+		total += w
+		c.currentWeight += w
+
+		if choice == nil || c.currentWeight > choice.currentWeight {
+			choice = c
+		}
+	}
+
+	if choice == nil {
+		return nil
+	}
+
+	choice.currentWeight -= total
+
+	return choice
+}
+
+// chooseNextAll runs a round among all the items without the slow start.
+func (b *swrr) chooseNextAll() (choice *swrrItem) {
 	total := 0
 	for i := range b.items {
 		c := b.items[i]
@@ -110,6 +208,63 @@ func (b *swrr) chooseNext() (choice *swrrItem) {
 	return choice
 }
 
+// SelectExcept gets next selected item other than the excluded items,
+// the round is run among the rest only, so that they stay smooth.
+func (b *swrr) SelectExcept(exclude []string, _ ...string) (item string) {
+	skip := excluded(exclude)
+	if skip == nil {
+		return b.Select()
+	}
+
+	b.Lock()
+	if c := b.chooseNext(skip); c != nil && c.weight > 0 {
+		item = c.item
+	}
+	b.Unlock()
+
+	return
+}
+
+// SelectN gets up to n distinct items, the rest are in the order they would win the next round.
+func (b *swrr) SelectN(n int, _ ...string) []string {
+	b.Lock()
+	defer b.Unlock()
+
+	p := newPicker(n, b.count)
+	if p.full() {
+		return nil
+	}
+	if b.count == 1 {
+		if b.items[0].weight > 0 {
+			p.add(b.items[0].item)
+		}
+		return p.result()
+	}
+
+	c := b.chooseNext(nil)
+	if c == nil || c.weight <= 0 {
+		return nil
+	}
+	p.add(c.item)
+
+	rest := make([]*swrrItem, 0, b.count-1)
+	for _, x := range b.items {
+		if x != c && x.weight > 0 {
+			rest = append(rest, x)
+		}
+	}
+	now := b.ss.now()
+	sort.SliceStable(rest, func(i, j int) bool {
+		return rest[i].currentWeight+b.weightOf(rest[i], now) > rest[j].currentWeight+b.weightOf(rest[j], now)
+	})
+	for _, x := range rest {
+		if p.add(x.item) {
+			break
+		}
+	}
+	return p.result()
+}
+
 func (b *swrr) Remove(item string, _ ...bool) bool {
 	b.Lock()
 	defer b.Unlock()
@@ -117,6 +272,15 @@ func (b *swrr) Remove(item string, _ ...bool) bool {
 	return b.remove(item)
 }
 
+func (b *swrr) indexOf(item string) int {
+	for i := 0; i < b.count; i++ {
+		if item == b.items[i].item {
+			return i
+		}
+	}
+	return -1
+}
+
 func (b *swrr) remove(item string) (ok bool) {
 	for i := 0; i < b.count; i++ {
 		if item == b.items[i].item {
@@ -141,7 +305,7 @@ func (b *swrr) RemoveAll() {
 func (b *swrr) Reset() {
 	b.Lock()
 	for i := range b.items {
-		b.items[i].currentWeight = b.items[i].weight
+		b.items[i].currentWeight = b.items[i].weight * b.scale
 	}
 	b.Unlock()
 }
@@ -152,22 +316,34 @@ func (b *swrr) Update(items interface{}) bool {
 		return false
 	}
 
-	count := len(v)
-	data := make([]*swrrItem, count)
-	i := 0
+	b.Lock()
+	defer b.Unlock()
+
+	// the retained items keep the order, the current weights and ramping up
+	data := make([]*swrrItem, 0, len(v))
+	retained := make(map[string]struct{}, b.count)
+	for _, c := range b.items {
+		if weight, ok := v[c.item]; ok {
+			c.weight = weight
+			data = append(data, c)
+			retained[c.item] = struct{}{}
+		}
+	}
+	// new items start to ramp up
+	all := make(map[string]int, len(v))
 	for item, weight := range v {
-		data[i] = &swrrItem{
-			item:   item,
-			weight: weight,
+		all[item] = weight
+		if _, ok := retained[item]; !ok {
+			data = append(data, &swrrItem{
+				item:   item,
+				weight: weight,
+				start:  b.ss.begin(),
+			})
 		}
-		i++
 	}
-
-	b.Lock()
-	b.count = count
-	b.all = v
+	b.count = len(data)
+	b.all = all
 	b.items = data
-	b.Unlock()
 
 	return true
 }
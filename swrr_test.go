@@ -1,9 +1,11 @@
 package balancer
 
 import (
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestSmoothWeightedRoundRobin(t *testing.T) {
@@ -92,6 +94,210 @@ func TestSmoothWeightedRoundRobin(t *testing.T) {
 	}
 }
 
+func TestSmoothWeightedRoundRobin_SelectN(t *testing.T) {
+	nodes := map[string]int{
+		"A": 0,
+		"B": 1,
+		"C": 7,
+		"D": 2,
+	}
+	lb := NewSmoothWeightedRoundRobin(nodes)
+	seq := NewSmoothWeightedRoundRobin()
+	for _, v := range lb.items {
+		seq.Add(v.item, v.weight)
+	}
+	for i := 0; i < 1000; i++ {
+		items := lb.SelectN(3)
+		if len(items) != 3 || items[0] != seq.Select() {
+			t.Fatalf("swrr select n wrong: %v", items)
+		}
+	}
+
+	// the rest are in the order they would win the next round without the first one
+	lb.Reset()
+	items := lb.SelectN(3)
+	if strings.Join(items, "") != "CDB" {
+		t.Fatalf("swrr expected CDB, actual %v", items)
+	}
+	item := lb.Select()
+	if item != "C" {
+		t.Fatalf("swrr expected C, actual %s", item)
+	}
+}
+
+func TestSmoothWeightedRoundRobin_SelectExcept(t *testing.T) {
+	nodes := map[string]int{
+		"A": 0,
+		"B": 1,
+		"C": 7,
+		"D": 2,
+	}
+	lb := NewSmoothWeightedRoundRobin(nodes)
+
+	// the rest stay smooth in proportion to their weights
+	items := ""
+	for i := 0; i < 6; i++ {
+		items += lb.SelectExcept([]string{"C"})
+	}
+	if strings.Count(items, "D") != 4 || strings.Count(items, "B") != 2 || strings.Contains(items, "DDD") {
+		t.Fatalf("swrr select except wrong: %s", items)
+	}
+
+	item := lb.SelectExcept([]string{"B", "C", "D"})
+	if item != "" {
+		t.Fatalf("swrr expected empty, actual %s", item)
+	}
+}
+
+func TestSmoothWeightedRoundRobin_SlowStart(t *testing.T) {
+	lb := NewSmoothWeightedRoundRobin(map[string]int{
+		"A": 1,
+		"B": 1,
+	})
+	lb.SetSlowStart(300 * time.Millisecond)
+	lb.Add("C", 1)
+	lb.Update(map[string]int{
+		"A": 1,
+		"B": 1,
+		"C": 1,
+		"D": 1,
+	})
+
+	// the new items get 10% of the weight at first
+	count := make(map[string]int)
+	for i := 0; i < 1100; i++ {
+		count[lb.Select()]++
+	}
+	if count["C"] > 100 || count["D"] > 100 || count["A"] < 400 || count["B"] < 400 {
+		t.Fatalf("swrr slow start wrong: %v", count)
+	}
+
+	// and the full weight at the end of the window
+	time.Sleep(310 * time.Millisecond)
+	count = make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		count[lb.Select()]++
+	}
+	for _, v := range count {
+		if v < 900 || v > 1100 {
+			t.Fatalf("swrr slow start wrong: %v", count)
+		}
+	}
+
+	// the items added later only
+	lb.SetSlowStart(0)
+	lb.Add("E", 4)
+	count = make(map[string]int)
+	for i := 0; i < 8000; i++ {
+		count[lb.Select()]++
+	}
+	if count["E"] < 3600 {
+		t.Fatalf("swrr slow start wrong: %v", count)
+	}
+}
+
+func TestSmoothWeightedRoundRobin_SetWeight(t *testing.T) {
+	nodes := map[string]int{
+		"A": 5,
+		"B": 1,
+		"C": 4,
+	}
+	lb := NewSmoothWeightedRoundRobin(nodes)
+	seq := NewSmoothWeightedRoundRobin()
+	for _, v := range lb.items {
+		seq.Add(v.item, v.weight)
+	}
+	for i := 0; i < 7; i++ {
+		if lb.Select() != seq.Select() {
+			t.Fatal("swrr wrong")
+		}
+	}
+
+	// the current weights are kept
+	lb.SetWeight("B", 1)
+	for i := 0; i < 100; i++ {
+		if lb.Select() != seq.Select() {
+			t.Fatal("swrr set weight wrong")
+		}
+	}
+
+	lb.SetWeight("B", 5)
+	count := make(map[string]int)
+	for i := 0; i < 1400; i++ {
+		count[lb.Select()]++
+	}
+	if count["A"] != 500 || count["B"] != 500 || count["C"] != 400 {
+		t.Fatalf("swrr set weight wrong: %v", count)
+	}
+}
+
+func TestSmoothWeightedRoundRobin_Update(t *testing.T) {
+	nodes := map[string]int{
+		"A": 5,
+		"B": 1,
+		"C": 4,
+	}
+	lb := NewSmoothWeightedRoundRobin(nodes)
+	seq := NewSmoothWeightedRoundRobin()
+	for _, v := range lb.items {
+		seq.Add(v.item, v.weight)
+	}
+	for i := 0; i < 7; i++ {
+		if lb.Select() != seq.Select() {
+			t.Fatal("swrr wrong")
+		}
+	}
+
+	// the current weights of the unchanged items are kept
+	lb.Update(map[string]int{
+		"A": 5,
+		"B": 1,
+		"C": 4,
+	})
+	for i := 0; i < 100; i++ {
+		if lb.Select() != seq.Select() {
+			t.Fatal("swrr update wrong")
+		}
+	}
+
+	lb.Update(map[string]int{
+		"A": 5,
+		"C": 4,
+		"D": 1,
+	})
+	if lb.items[2].item != "D" {
+		t.Fatal("swrr update wrong")
+	}
+	count := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		count[lb.Select()]++
+	}
+	if count["A"] != 500 || count["B"] != 0 || count["C"] != 400 || count["D"] != 100 {
+		t.Fatalf("swrr update wrong: %v", count)
+	}
+}
+
+func TestSmoothWeightedRoundRobin_Update_SameMap(t *testing.T) {
+	nodes := map[string]int{"A": 1}
+	lb := NewSmoothWeightedRoundRobin(nodes)
+
+	// the map of the caller is reused
+	nodes["B"] = 1
+	lb.Update(nodes)
+	count := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		count[lb.Select()]++
+	}
+	if count["A"] != 50 || count["B"] != 50 {
+		t.Fatalf("swrr update wrong: %v", count)
+	}
+
+	nodes["C"] = 1
+	if all := lb.All().(map[string]int); len(all) != 2 {
+		t.Fatalf("swrr all wrong: %v", all)
+	}
+}
+
 func TestSmoothWeightedRoundRobin_C(t *testing.T) {
 	var (
 		a, b, c, d int64
@@ -1,21 +1,15 @@
 package utils
 
 import (
-	"reflect"
 	"unsafe"
 )
 
 // S2B StringToBytes
-func S2B(s string) (b []byte) {
-	sh := *(*reflect.StringHeader)(unsafe.Pointer(&s))
-	bh := (*reflect.SliceHeader)(unsafe.Pointer(&b))
-	bh.Data = sh.Data
-	bh.Cap = sh.Len
-	bh.Len = sh.Len
-	return
+func S2B(s string) []byte {
+	return unsafe.Slice(unsafe.StringData(s), len(s))
 }
 
 // B2S BytesToString
 func B2S(b []byte) string {
-	return *(*string)(unsafe.Pointer(&b))
+	return unsafe.String(unsafe.SliceData(b), len(b))
 }
@@ -19,3 +19,13 @@ func Sum64(s string) uint64 {
 	}
 	return h
 }
+
+// Fmix64 the finalizer of MurmurHash3, makes every bit of h affect all the bits of the result.
+func Fmix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,282 @@
+package balancer
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// WeightedLeastConnections
+// Selects the item with the fewest in-flight requests per weight,
+// ties are broken in smooth weighted round-robin order.
+type wlc struct {
+	items []*wlcItem
+	count int
+	all   map[string]int
+
+	sync.Mutex
+}
+
+type wlcItem struct {
+	item          string
+	weight        int
+	currentWeight int
+	inflight      int64
+}
+
+func NewWeightedLeastConnections(items ...map[string]int) (lb *wlc) {
+	if len(items) > 0 && len(items[0]) > 0 {
+		lb = &wlc{}
+		lb.Update(items[0])
+		return
+	}
+	return &wlc{
+		all: make(map[string]int),
+	}
+}
+
+func (b *wlc) Add(item string, weight ...int) {
+	w := 1
+	if len(weight) > 0 {
+		w = weight[0]
+	}
+
+	b.Lock()
+	b.add(item, w)
+	b.Unlock()
+}
+
+func (b *wlc) add(item string, weight int) {
+	b.all[item] = weight
+	for i := 0; i < b.count; i++ {
+		if item == b.items[i].item {
+			b.items[i].weight = weight
+			return
+		}
+	}
+	b.items = append(b.items, &wlcItem{
+		item:   item,
+		weight: weight,
+	})
+	b.count++
+}
+
+// SetWeight sets the weight of the item in place, keeping the in-flight requests and the current weights.
+func (b *wlc) SetWeight(item string, weight int) {
+	b.Lock()
+	b.add(item, weight)
+	b.Unlock()
+}
+
+func (b *wlc) All() interface{} {
+	all := make(map[string]int)
+
+	b.Lock()
+	for k, v := range b.all {
+		all[k] = v
+	}
+	b.Unlock()
+
+	return all
+}
+
+func (b *wlc) Name() string {
+	return "WeightedLeastConnections"
+}
+
+func (b *wlc) Select(_ ...string) (item string) {
+	b.Lock()
+	if c := b.chooseNext(nil); c != nil {
+		item = c.item
+	}
+	b.Unlock()
+
+	return
+}
+
+// Acquire gets next selected item and counts an in-flight request on it.
+func (b *wlc) Acquire(key ...string) (string, func()) {
+	return b.AcquireExcept(nil, key...)
+}
+
+// AcquireExcept gets next selected item other than the excluded items and counts an in-flight request on it.
+func (b *wlc) AcquireExcept(exclude []string, _ ...string) (string, func()) {
+	b.Lock()
+	c := b.chooseNext(excluded(exclude))
+	if c == nil {
+		b.Unlock()
+		return "", noop
+	}
+	atomic.AddInt64(&c.inflight, 1)
+	b.Unlock()
+
+	return c.item, releaser(&c.inflight)
+}
+
+// SelectExcept gets the least loaded item in proportion to the weights other than the excluded items.
+func (b *wlc) SelectExcept(exclude []string, _ ...string) (item string) {
+	skip := excluded(exclude)
+	if skip == nil {
+		return b.Select()
+	}
+
+	b.Lock()
+	if c := b.chooseNext(skip); c != nil {
+		item = c.item
+	}
+	b.Unlock()
+
+	return
+}
+
+// SelectN gets up to n distinct items in the order of the in-flight requests per weight.
+func (b *wlc) SelectN(n int, _ ...string) []string {
+	b.Lock()
+	defer b.Unlock()
+
+	p := newPicker(n, b.count)
+	if p.full() {
+		return nil
+	}
+	c := b.chooseNext(nil)
+	if c == nil {
+		return nil
+	}
+	p.add(c.item)
+
+	type ratio struct {
+		*wlcItem
+		inflight int64
+	}
+	rest := make([]ratio, 0, b.count-1)
+	for _, x := range b.items {
+		if x != c && x.weight > 0 {
+			rest = append(rest, ratio{x, atomic.LoadInt64(&x.inflight)})
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		x, y := rest[i], rest[j]
+		if l, r := x.inflight*int64(y.weight), y.inflight*int64(x.weight); l != r {
+			return l < r
+		}
+		return x.currentWeight+x.weight > y.currentWeight+y.weight
+	})
+	for _, x := range rest {
+		if p.add(x.item) {
+			break
+		}
+	}
+	return p.result()
+}
+
+func (b *wlc) chooseNext(skip func(string) bool) (choice *wlcItem) {
+	// the least in-flight/weight, compared as: a.inflight*b.weight < b.inflight*a.weight
+	var least *wlcItem
+	leastInflight := int64(0)
+	for _, c := range b.items {
+		if c.weight <= 0 || skip != nil && skip(c.item) {
+			continue
+		}
+		inflight := atomic.LoadInt64(&c.inflight)
+		if least == nil || inflight*int64(least.weight) < leastInflight*int64(c.weight) {
+			least = c
+			leastInflight = inflight
+		}
+	}
+	if least == nil {
+		return nil
+	}
+
+	// smooth weighted round-robin among the tied items
+	total := 0
+	for _, c := range b.items {
+		if c.weight <= 0 || skip != nil && skip(c.item) {
+			continue
+		}
+		inflight := atomic.LoadInt64(&c.inflight)
+		if inflight*int64(least.weight) != leastInflight*int64(c.weight) {
+			continue
+		}
+
+		total += c.weight
+		c.currentWeight += c.weight
+
+		if choice == nil || c.currentWeight > choice.currentWeight {
+			choice = c
+		}
+	}
+	if choice == nil {
+		// in-flight counters changed between the two passes
+		return least
+	}
+
+	choice.currentWeight -= total
+
+	return choice
+}
+
+func (b *wlc) Remove(item string, _ ...bool) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	for i := 0; i < b.count; i++ {
+		if item == b.items[i].item {
+			b.items = append(b.items[:i], b.items[i+1:]...)
+			b.count--
+			delete(b.all, item)
+			return true
+		}
+	}
+	return false
+}
+
+func (b *wlc) RemoveAll() {
+	b.Lock()
+	b.items = b.items[:0]
+	b.count = 0
+	b.all = make(map[string]int)
+	b.Unlock()
+}
+
+func (b *wlc) Reset() {
+	b.Lock()
+	for i := range b.items {
+		b.items[i].currentWeight = 0
+	}
+	b.Unlock()
+}
+
+func (b *wlc) Update(items interface{}) bool {
+	v, ok := items.(map[string]int)
+	if !ok {
+		return false
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	// keep the in-flight counters of the retained items
+	old := make(map[string]*wlcItem, b.count)
+	for _, x := range b.items {
+		old[x.item] = x
+	}
+
+	data := make([]*wlcItem, 0, len(v))
+	all := make(map[string]int, len(v))
+	for item, weight := range v {
+		all[item] = weight
+		x, ok := old[item]
+		if !ok {
+			x = &wlcItem{item: item}
+		}
+		x.weight = weight
+		x.currentWeight = 0
+		data = append(data, x)
+	}
+
+	b.items = data
+	b.count = len(data)
+	b.all = all
+
+	return true
+}
@@ -0,0 +1,232 @@
+package balancer
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWeightedLeastConnections(t *testing.T) {
+	lb := NewWeightedLeastConnections()
+	item := lb.Select()
+	if item != "" {
+		t.Fatalf("wlc expected empty, actual %s", item)
+	}
+
+	lb.Add("A", 0)
+	item, done := lb.Acquire()
+	if item != "" {
+		t.Fatalf("wlc expected empty, actual %s", item)
+	}
+	done()
+	lb.Add("B", 1)
+	item = lb.Select()
+	if item != "B" {
+		t.Fatalf("wlc expected B, actual %s", item)
+	}
+
+	nodes := map[string]int{
+		"A": 0,
+		"B": 1,
+		"C": 7,
+		"D": 2,
+	}
+	lb = NewWeightedLeastConnections(nodes)
+
+	// without feedback, it is the same as SmoothWeightedRoundRobin
+	count := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		item := lb.Select()
+		count[item]++
+	}
+	if count["A"] != 0 || count["B"] != 100 || count["C"] != 700 || count["D"] != 200 {
+		t.Fatal("wlc wrong")
+	}
+
+	// in-flight requests are spread in proportion to the weights
+	count = make(map[string]int)
+	var dones []func()
+	for i := 0; i < 100; i++ {
+		item, done := lb.Acquire()
+		count[item]++
+		dones = append(dones, done)
+	}
+	if count["A"] != 0 || count["B"] != 10 || count["C"] != 70 || count["D"] != 20 {
+		t.Fatal("wlc acquire wrong")
+	}
+
+	// the item with the least in-flight/weight is preferred
+	for _, done := range dones[:50] {
+		done()
+	}
+	lb.Reset()
+	for i := 0; i < 10; i++ {
+		_, done := lb.Acquire()
+		dones[i] = done
+	}
+	for _, done := range dones {
+		done()
+	}
+	for _, v := range lb.items {
+		if atomic.LoadInt64(&v.inflight) != 0 {
+			t.Fatalf("wlc wrong: %s in-flight %d", v.item, v.inflight)
+		}
+	}
+
+	c, doneC := lb.Acquire()
+	if c != "C" {
+		t.Fatalf("wlc expected C, actual %s", c)
+	}
+	lb.Add("C", 1)
+	for i := 0; i < 10; i++ {
+		item := lb.Select()
+		if item == "C" {
+			t.Fatal("wlc add() wrong")
+		}
+	}
+	doneC()
+
+	ok := lb.Remove("C")
+	if ok != true {
+		t.Fatal("wlc remove() wrong")
+	}
+	all, ok := lb.All().(map[string]int)
+	if !ok || len(all) != 3 || all["D"] != 2 {
+		t.Fatal("wlc all() wrong")
+	}
+
+	ok = lb.Update([]string{"X"})
+	if ok != false {
+		t.Fatal("wlc update wrong")
+	}
+
+	lb.Update(map[string]int{"D": 1})
+	_, doneD := lb.Acquire()
+	ok = lb.Update(map[string]int{
+		"D": 1,
+		"X": 1,
+	})
+	if ok != true {
+		t.Fatal("wlc update wrong")
+	}
+	for i := 0; i < 10; i++ {
+		item := lb.Select()
+		if item != "X" {
+			t.Fatalf("wlc expected X, actual %s", item)
+		}
+	}
+	doneD()
+
+	lb.RemoveAll()
+	lb.Add("F", 2)
+	lb.Add("F", 1)
+	all, ok = lb.All().(map[string]int)
+	if !ok || all["F"] != 1 {
+		t.Fatal("wlc all() wrong")
+	}
+}
+
+func TestWeightedLeastConnections_SelectN(t *testing.T) {
+	lb := NewWeightedLeastConnections(map[string]int{
+		"A": 0,
+		"B": 1,
+		"C": 7,
+		"D": 2,
+	})
+	_, doneC := lb.Acquire()
+	items := lb.SelectN(5)
+	if strings.Join(items, "") != "DBC" {
+		t.Fatalf("wlc expected DBC, actual %v", items)
+	}
+	doneC()
+}
+
+func TestWeightedLeastConnections_Update(t *testing.T) {
+	nodes := map[string]int{"A": 1, "B": 1}
+	lb := NewWeightedLeastConnections(nodes)
+
+	// the map of the caller is not changed
+	lb.Add("X", 3)
+	lb.Remove("A")
+	if len(nodes) != 2 || nodes["A"] != 1 || nodes["B"] != 1 {
+		t.Fatalf("wlc update wrong: %v", nodes)
+	}
+	if all := lb.All().(map[string]int); len(all) != 2 || all["X"] != 3 {
+		t.Fatalf("wlc all wrong: %v", all)
+	}
+}
+
+func TestWeightedLeastConnections_C(t *testing.T) {
+	var (
+		a, b, c, d int64
+	)
+	nodes := map[string]int{
+		"A": 5,
+		"B": 1,
+		"C": 4,
+		"D": 0,
+	}
+	lb := NewWeightedLeastConnections(nodes)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				item, done := lb.Acquire()
+				switch item {
+				case "A":
+					atomic.AddInt64(&a, 1)
+				case "B":
+					atomic.AddInt64(&b, 1)
+				case "C":
+					atomic.AddInt64(&c, 1)
+				case "D":
+					atomic.AddInt64(&d, 1)
+				}
+				done()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if atomic.LoadInt64(&d) != 0 {
+		t.Fatal("wlc wrong: d")
+	}
+	if atomic.LoadInt64(&a)+atomic.LoadInt64(&b)+atomic.LoadInt64(&c) != 1000000 {
+		t.Fatal("wlc wrong: sum")
+	}
+	for _, v := range lb.items {
+		if atomic.LoadInt64(&v.inflight) != 0 {
+			t.Fatalf("wlc wrong: %s in-flight %d", v.item, v.inflight)
+		}
+	}
+
+	// the requests held in flight follow the weights
+	dones := make(chan func(), 500)
+	for i := 0; i < 500; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, done := lb.Acquire()
+			dones <- done
+		}()
+	}
+	wg.Wait()
+	close(dones)
+	for _, v := range lb.items {
+		if n := atomic.LoadInt64(&v.inflight); n != int64(v.weight)*50 {
+			t.Fatalf("wlc expected %s in-flight %d, actual %d", v.item, v.weight*50, n)
+		}
+	}
+	for done := range dones {
+		done()
+	}
+	for _, v := range lb.items {
+		if atomic.LoadInt64(&v.inflight) != 0 {
+			t.Fatalf("wlc wrong: %s in-flight %d", v.item, v.inflight)
+		}
+	}
+}
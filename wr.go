@@ -1,37 +1,98 @@
 package balancer
 
 import (
+	"math"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/fufuok/balancer/utils"
 )
 
 // WeightedRand
 type wr struct {
-	items   []*wrItem
-	weights []int
-	count   int
-	max     uint32
-	all     map[string]int
+	state atomic.Pointer[wrState]
 
-	sync.RWMutex
+	sync.Mutex
+}
+
+// wrState is a snapshot of the items, never modified after published.
+type wrState struct {
+	items []*wrItem
+	count int
+	max   uint32
+	all   map[string]int
+	ss    *slowStart
+
+	// the alias table of the weights, see newAlias
+	prob  []uint32
+	alias []uint32
 }
 
 type wrItem struct {
 	item   string
 	weight int
+	start  int64
 }
 
 func NewWeightedRand(items ...map[string]int) (lb *wr) {
+	lb = &wr{}
+	lb.state.Store(&wrState{
+		all: make(map[string]int),
+		ss:  &slowStart{},
+	})
 	if len(items) > 0 && len(items[0]) > 0 {
-		lb = &wr{}
 		lb.Update(items[0])
-		return
 	}
-	return &wr{
-		all: make(map[string]int),
+	return
+}
+
+// load gets the snapshot of the items.
+func (b *wr) load() *wrState {
+	return b.state.Load()
+}
+
+// SetSlowStart ramps up the weights of the items added later from 10% to 100% in the window, 0 disables it.
+// aggression 1 (default) ramps up linearly, the greater the faster at first.
+func (b *wr) SetSlowStart(window time.Duration, aggression ...float64) {
+	b.Lock()
+	old := b.load()
+	s := *old
+	s.ss = &slowStart{until: atomic.LoadInt64(&old.ss.until)}
+	s.ss.set(window, aggression...)
+	b.state.Store(&s)
+	b.Unlock()
+}
+
+// weightOf gets the current weight of the item.
+func (s *wrState) weightOf(c *wrItem, now int64) float64 {
+	return float64(c.weight) * s.ss.factor(c.start, now)
+}
+
+// ramped selects an item in proportion to the current weights while ramping up.
+func (s *wrState) ramped(now int64, skip func(string) bool) string {
+	total := 0.0
+	for _, c := range s.items {
+		if skip == nil || !skip(c.item) {
+			total += s.weightOf(c, now)
+		}
 	}
+	if total == 0 {
+		return ""
+	}
+	r := float64(utils.FastRandn(math.MaxUint32)) / math.MaxUint32 * total
+	item := ""
+	for _, c := range s.items {
+		if skip != nil && skip(c.item) {
+			continue
+		}
+		item = c.item
+		if r -= s.weightOf(c, now); r < 0 {
+			break
+		}
+	}
+	return item
 }
 
 func (b *wr) Add(item string, weight ...int) {
@@ -40,20 +101,62 @@ func (b *wr) Add(item string, weight ...int) {
 		w = weight[0]
 	}
 
-	all := b.All().(map[string]int)
+	b.Lock()
+	all := b.copyAll()
 	all[item] = w
-	b.Update(all)
+	b.update(all)
+	b.Unlock()
+}
+
+// SetWeight sets the weight of the item, only the alias table is rebuilt.
+func (b *wr) SetWeight(item string, weight int) {
+	b.Lock()
+	defer b.Unlock()
+
+	old := b.load()
+	all := b.copyAll()
+	all[item] = weight
+
+	i := -1
+	for j, c := range old.items {
+		if item == c.item {
+			i = j
+			break
+		}
+	}
+	if i < 0 || weight <= 0 {
+		b.update(all)
+		return
+	}
+
+	items := make([]*wrItem, old.count)
+	copy(items, old.items)
+	c := *items[i]
+	c.weight = weight
+	items[i] = &c
+	max := int(old.max) - old.items[i].weight + weight
+	prob, alias := newAlias(items, max)
+	b.state.Store(&wrState{
+		items: items,
+		count: old.count,
+		max:   uint32(max),
+		all:   all,
+		ss:    old.ss,
+		prob:  prob,
+		alias: alias,
+	})
 }
 
 func (b *wr) All() interface{} {
-	all := make(map[string]int)
+	return b.copyAll()
+}
 
-	b.RLock()
-	for k, v := range b.all {
+func (b *wr) copyAll() map[string]int {
+	s := b.load()
+	all := make(map[string]int, len(s.all))
+	for k, v := range s.all {
 		all[k] = v
 	}
-	b.RUnlock()
-
 	return all
 }
 
@@ -62,42 +165,163 @@ func (b *wr) Name() string {
 }
 
 func (b *wr) Select(_ ...string) (item string) {
-	b.RLock()
-	switch b.count {
+	s := b.load()
+	switch s.count {
 	case 0:
 		item = ""
 	case 1:
-		item = b.items[0].item
+		item = s.items[0].item
 	default:
-		r := utils.FastRandn(b.max) + 1
-		i := utils.SearchInts(b.weights, int(r))
-		item = b.items[i].item
+		if now := s.ss.now(); now != 0 {
+			item = s.ramped(now, nil)
+			break
+		}
+		item = s.items[s.sample()].item
+	}
+
+	return
+}
+
+// sample gets the index of an item in proportion to the weights in constant time.
+func (s *wrState) sample() uint32 {
+	i := utils.FastRandn(uint32(s.count))
+	if utils.FastRandn(s.max) < s.prob[i] {
+		return i
 	}
-	b.RUnlock()
+	return s.alias[i]
+}
 
+// newAlias builds the alias table of the weights, the total of which is max:
+// each of the columns of the height max has the item itself below prob, and the alias above.
+// Ref: https://www.keithschwarz.com/darts-dice-coins/ (Vose's Alias Method)
+func newAlias(items []*wrItem, max int) (prob, alias []uint32) {
+	n := len(items)
+	prob = make([]uint32, n)
+	alias = make([]uint32, n)
+	scaled := make([]int64, n)
+	small := make([]int, 0, n)
+	large := make([]int, 0, n)
+	for i, c := range items {
+		scaled[i] = int64(c.weight) * int64(n)
+		if scaled[i] < int64(max) {
+			small = append(small, i)
+		} else {
+			large = append(large, i)
+		}
+	}
+	for len(small) > 0 && len(large) > 0 {
+		l, g := small[len(small)-1], large[len(large)-1]
+		small, large = small[:len(small)-1], large[:len(large)-1]
+		prob[l] = uint32(scaled[l])
+		alias[l] = uint32(g)
+		// the rest of the column l is filled by g
+		scaled[g] -= int64(max) - scaled[l]
+		if scaled[g] < int64(max) {
+			small = append(small, g)
+		} else {
+			large = append(large, g)
+		}
+	}
+	for _, i := range append(small, large...) {
+		prob[i] = uint32(max)
+		alias[i] = uint32(i)
+	}
 	return
 }
 
+// SelectExcept gets next selected item other than the excluded items, in proportion to the weights of the rest.
+func (b *wr) SelectExcept(exclude []string, _ ...string) (item string) {
+	skip := excluded(exclude)
+	if skip == nil {
+		return b.Select()
+	}
+
+	s := b.load()
+	if s.count == 0 {
+		return
+	}
+	if now := s.ss.now(); now != 0 {
+		return s.ramped(now, skip)
+	}
+	for i := 0; i < 8; i++ {
+		if x := s.items[s.sample()].item; !skip(x) {
+			return x
+		}
+	}
+
+	// most of the weights are excluded
+	total := 0
+	for _, c := range s.items {
+		if !skip(c.item) {
+			total += c.weight
+		}
+	}
+	if total == 0 {
+		return
+	}
+	r := int(utils.FastRandn(uint32(total))) + 1
+	for _, c := range s.items {
+		if skip(c.item) {
+			continue
+		}
+		if r -= c.weight; r <= 0 {
+			return c.item
+		}
+	}
+	return
+}
+
+// SelectN gets up to n distinct items by weighted random sampling without replacement.
+// Ref: https://doi.org/10.1016/j.ipl.2005.11.003 (Weighted random sampling with a reservoir)
+func (b *wr) SelectN(n int, _ ...string) []string {
+	s := b.load()
+	p := newPicker(n, s.count)
+	if p.full() {
+		return nil
+	}
+
+	type sample struct {
+		item string
+		key  float64
+	}
+	now := s.ss.now()
+	samples := make([]sample, s.count)
+	for i, c := range s.items {
+		u := (float64(utils.FastRandn(math.MaxUint32)) + 0.5) / math.MaxUint32
+		samples[i] = sample{
+			item: c.item,
+			key:  math.Log(u) / s.weightOf(c, now),
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].key > samples[j].key
+	})
+	for _, x := range samples {
+		if p.add(x.item) {
+			break
+		}
+	}
+	return p.result()
+}
+
 func (b *wr) Remove(item string, _ ...bool) (ok bool) {
-	b.RLock()
-	_, ok = b.all[item]
-	b.RUnlock()
+	b.Lock()
+	defer b.Unlock()
 
-	if ok {
-		all := b.All().(map[string]int)
+	if _, ok = b.load().all[item]; ok {
+		all := b.copyAll()
 		delete(all, item)
-		b.Update(all)
+		b.update(all)
 	}
 	return
 }
 
 func (b *wr) RemoveAll() {
 	b.Lock()
-	b.items = b.items[:0]
-	b.weights = b.weights[:0]
-	b.count = 0
-	b.max = 0
-	b.all = make(map[string]int)
+	b.state.Store(&wrState{
+		all: make(map[string]int),
+		ss:  b.load().ss,
+	})
 	b.Unlock()
 }
 
@@ -109,6 +333,20 @@ func (b *wr) Update(items interface{}) bool {
 		return false
 	}
 
+	all := make(map[string]int, len(v))
+	for k, w := range v {
+		all[k] = w
+	}
+
+	b.Lock()
+	b.update(all)
+	b.Unlock()
+
+	return true
+}
+
+// update publishes a new snapshot of the items, the lock must be held, v is not copied.
+func (b *wr) update(v map[string]int) {
 	var (
 		count int
 		data  []*wrItem
@@ -124,24 +362,34 @@ func (b *wr) Update(items interface{}) bool {
 		}
 	}
 
-	sort.Slice(data, func(i, j int) bool {
-		return data[i].weight < data[j].weight
-	})
-
 	max := 0
-	weights := make([]int, count)
-	for i := range data {
-		max += data[i].weight
-		weights[i] = max
+	for _, c := range data {
+		max += c.weight
 	}
+	prob, alias := newAlias(data, max)
 
-	b.Lock()
-	b.items = data
-	b.weights = weights
-	b.count = count
-	b.max = uint32(max)
-	b.all = v
-	b.Unlock()
-
-	return true
+	old := b.load()
+	if old.ss.window > 0 {
+		// new items start to ramp up, the others keep ramping up
+		starts := make(map[string]int64, old.count)
+		for _, c := range old.items {
+			starts[c.item] = c.start
+		}
+		for _, c := range data {
+			if start, ok := starts[c.item]; ok {
+				c.start = start
+			} else {
+				c.start = old.ss.begin()
+			}
+		}
+	}
+	b.state.Store(&wrState{
+		items: data,
+		count: count,
+		max:   uint32(max),
+		all:   v,
+		ss:    old.ss,
+		prob:  prob,
+		alias: alias,
+	})
 }
@@ -1,9 +1,11 @@
 package balancer
 
 import (
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestWeightedRand(t *testing.T) {
@@ -79,6 +81,106 @@ func TestWeightedRand(t *testing.T) {
 	}
 }
 
+func TestWeightedRand_SelectN(t *testing.T) {
+	nodes := map[string]int{
+		"A": 0,
+		"B": 1,
+		"C": 7,
+		"D": 2,
+	}
+	lb := NewWeightedRand(nodes)
+	first := make(map[string]int)
+	second := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		items := lb.SelectN(5)
+		if len(items) != 3 || items[0] == items[1] {
+			t.Fatalf("wr select n wrong: %v", items)
+		}
+		first[items[0]]++
+		second[items[1]]++
+	}
+	if first["B"] <= 150 || first["C"] <= 1300 || first["D"] <= 250 {
+		t.Fatalf("wr select n wrong: %v", first)
+	}
+	if second["C"] >= 1000 || second["D"] <= second["B"] {
+		t.Fatalf("wr select n wrong: %v", second)
+	}
+}
+
+func TestWeightedRand_SlowStart(t *testing.T) {
+	lb := NewWeightedRand(map[string]int{
+		"A": 1,
+		"B": 1,
+	})
+	lb.SetSlowStart(300 * time.Millisecond)
+	lb.Add("C", 1)
+	lb.Update(map[string]int{
+		"A": 1,
+		"B": 1,
+		"C": 1,
+		"D": 1,
+	})
+
+	// the new items get 10% of the weight at first
+	count := make(map[string]int)
+	for i := 0; i < 1100; i++ {
+		count[lb.Select()]++
+	}
+	if count["C"] > 100 || count["D"] > 100 || count["A"] < 400 || count["B"] < 400 {
+		t.Fatalf("wr slow start wrong: %v", count)
+	}
+
+	// and the full weight at the end of the window
+	time.Sleep(310 * time.Millisecond)
+	count = make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		count[lb.Select()]++
+	}
+	for _, v := range count {
+		if v < 900 || v > 1100 {
+			t.Fatalf("wr slow start wrong: %v", count)
+		}
+	}
+
+	// the items added later only
+	lb.SetSlowStart(0)
+	lb.Add("E", 4)
+	count = make(map[string]int)
+	for i := 0; i < 8000; i++ {
+		count[lb.Select()]++
+	}
+	if count["E"] < 3600 {
+		t.Fatalf("wr slow start wrong: %v", count)
+	}
+}
+
+func TestWeightedRand_Alias(t *testing.T) {
+	nodes := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		nodes[strconv.Itoa(i)] = i%7 + i%3*100
+	}
+	lb := NewWeightedRand(nodes)
+	s := lb.load()
+	if len(s.prob) != s.count || len(s.alias) != s.count {
+		t.Fatal("wr alias wrong")
+	}
+
+	// the columns add up to the weights exactly
+	mass := make([]int64, s.count)
+	for i := range s.prob {
+		if s.prob[i] > s.max {
+			t.Fatalf("wr alias wrong: %d", s.prob[i])
+		}
+		mass[i] += int64(s.prob[i])
+		mass[s.alias[i]] += int64(s.max - s.prob[i])
+	}
+	for i, c := range s.items {
+		if mass[i] != int64(c.weight)*int64(s.count) {
+			t.Fatalf("wr alias wrong: %s %d %d", c.item, mass[i], c.weight)
+		}
+	}
+}
+
 func TestWeightedRand_C(t *testing.T) {
 	var (
 		a, b, c, d int64
@@ -2,6 +2,8 @@ package balancer
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/fufuok/balancer/utils"
 )
@@ -9,31 +11,180 @@ import (
 // Weighted Round-Robin Scheduling
 // Ref: http://kb.linuxvirtualserver.org/wiki/Weighted_Round-Robin_Scheduling
 type wrr struct {
+	state atomic.Pointer[wrrState]
+	ss    slowStart
+	scale int
+
+	sync.Mutex
+}
+
+// wrrState is a snapshot of the items, only next is modified after published.
+type wrrState struct {
 	items []*wrrItem
-	i     int
 	n     int
-	cw    int
 	gcd   int
 	max   int
 	all   map[string]int
 
-	sync.Mutex
+	// the effective weights are ramping up, and recomputed at due
+	ramped bool
+	due    int64
+
+	// the count of the steps taken in the sequence, the step k is at (k % n, max - (k / n % (max / gcd)) * gcd)
+	next uint64
 }
 
 type wrrItem struct {
 	item   string
 	weight int
+	eff    int
+	start  int64
 }
 
 func NewWeightedRoundRobin(items ...map[string]int) (lb *wrr) {
+	lb = &wrr{scale: 1}
+	lb.state.Store(&wrrState{
+		all: make(map[string]int),
+	})
 	if len(items) > 0 && len(items[0]) > 0 {
-		lb = &wrr{}
 		lb.Update(items[0])
+	}
+	return
+}
+
+// load gets the snapshot of the items.
+func (b *wrr) load() *wrrState {
+	return b.state.Load()
+}
+
+// SetSlowStart ramps up the weights of the items added later from 10% to 100% in the window, 0 disables it.
+// aggression 1 (default) ramps up linearly, the greater the faster at first.
+func (b *wrr) SetSlowStart(window time.Duration, aggression ...float64) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.ss.set(window, aggression...)
+	b.scale = 1
+	if b.ss.window > 0 {
+		b.scale = slowStartScale
+	}
+	s := b.load().clone()
+	b.refresh(s, b.ss.now())
+	b.state.Store(s)
+}
+
+// modify publishes a copy of the snapshot changed by fn, keeping the position in the sequence.
+// The lock must be held.
+func (b *wrr) modify(fn func(s *wrrState)) {
+	old := b.load()
+	s := old.clone()
+	fn(s)
+	b.refresh(s, b.ss.now())
+	s.rebase(old)
+	b.state.Store(s)
+}
+
+func (s *wrrState) clone() *wrrState {
+	c := &wrrState{
+		items:  make([]*wrrItem, len(s.items)),
+		n:      s.n,
+		gcd:    s.gcd,
+		max:    s.max,
+		all:    make(map[string]int, len(s.all)),
+		ramped: s.ramped,
+		due:    s.due,
+	}
+	for i, x := range s.items {
+		v := *x
+		c.items[i] = &v
+	}
+	for k, v := range s.all {
+		c.all[k] = v
+	}
+	return c
+}
+
+// effOf gets the effective weight of the item at now, and whether the item ends ramping up.
+func (b *wrr) effOf(c *wrrItem, now int64) (eff int, done bool) {
+	eff = c.weight * b.scale
+	if c.start != 0 && now != 0 && eff > 0 {
+		if f := b.ss.factor(c.start, now); f < 1 {
+			if eff = int(float64(eff) * f); eff < 1 {
+				eff = 1
+			}
+			return
+		}
+		done = true
+	}
+	return
+}
+
+// refresh updates the effective weights at now, and the gcd and max of them.
+func (b *wrr) refresh(s *wrrState, now int64) {
+	s.gcd, s.max = 0, 0
+	for _, c := range s.items {
+		var done bool
+		if c.eff, done = b.effOf(c, now); done {
+			c.start = 0
+		}
+		if c.eff > 0 {
+			s.gcd = utils.GCD(s.gcd, c.eff)
+			if c.eff > s.max {
+				s.max = c.eff
+			}
+		}
+	}
+	s.ramped = now != 0
+	s.due = 0
+	if s.ramped {
+		s.due = now + b.ss.step()
+	}
+}
+
+// ramp refreshes the effective weights at each step of the slow start, and once more at the end.
+// Only one caller refreshes them, the others go on with the snapshot without waiting.
+func (b *wrr) ramp(s *wrrState) *wrrState {
+	now := b.ss.now()
+	if now == 0 && !s.ramped || now != 0 && now < s.due {
+		return s
+	}
+	if !b.TryLock() {
+		return s
+	}
+	defer b.Unlock()
+
+	if s = b.load(); s.ramped != (now != 0) || now >= s.due {
+		b.modify(func(*wrrState) {})
+	}
+	return b.load()
+}
+
+// at gets the position (i, cw) of the step k in the sequence.
+func (s *wrrState) at(k uint64) (i, cw int) {
+	i = int(k % uint64(s.n))
+	r := k / uint64(s.n) % uint64(s.max/s.gcd)
+	cw = s.max - int(r)*s.gcd
+	return
+}
+
+// rebase continues the sequence of s from the last position of old, after the same item if retained.
+func (s *wrrState) rebase(old *wrrState) {
+	k := atomic.LoadUint64(&old.next)
+	if k == 0 || old.n == 0 || old.max == 0 || s.n == 0 || s.max == 0 {
+		s.next = 0
 		return
 	}
-	return &wrr{
-		all: make(map[string]int),
+	i, cw := old.at(k - 1)
+	if j := s.indexOf(old.items[i].item); j >= 0 {
+		i = j
+	} else if i >= s.n {
+		i = s.n - 1
+	}
+	if cw > s.max {
+		cw = s.max
 	}
+	r := (s.max - cw) / s.gcd
+	s.next = uint64(r*s.n+i) + 1
 }
 
 func (b *wrr) Add(item string, weight ...int) {
@@ -43,48 +194,58 @@ func (b *wrr) Add(item string, weight ...int) {
 	}
 
 	b.Lock()
-	b.add(item, w)
+	b.modify(func(s *wrrState) {
+		b.add(s, item, w)
+	})
 	b.Unlock()
 }
 
-func (b *wrr) add(item string, weight int) {
-	b.remove(item)
-
-	b.items = append(b.items, &wrrItem{
+func (b *wrr) add(s *wrrState, item string, weight int) {
+	c := &wrrItem{
 		item:   item,
 		weight: weight,
+	}
+	if i := s.indexOf(item); i >= 0 {
+		c.start = s.items[i].start
+	} else {
+		c.start = b.ss.begin()
+	}
+	s.remove(item)
+
+	s.items = append(s.items, c)
+	s.n++
+	s.all[item] = weight
+}
+
+// SetWeight sets the weight of the item, keeping the position in the sequence.
+func (b *wrr) SetWeight(item string, weight int) {
+	b.Lock()
+	b.modify(func(s *wrrState) {
+		if i := s.indexOf(item); i >= 0 {
+			s.items[i].weight = weight
+			s.all[item] = weight
+			return
+		}
+		b.add(s, item, weight)
 	})
-	b.n++
-	b.all[item] = weight
-
-	b.addSettings(weight)
-}
-
-func (b *wrr) addSettings(weight int) {
-	if weight > 0 {
-		if b.gcd == 0 {
-			b.i = -1
-			b.cw = 0
-			b.gcd = weight
-			b.max = weight
-		} else {
-			b.gcd = utils.GCD(b.gcd, weight)
-			if b.max < weight {
-				b.max = weight
-			}
+	b.Unlock()
+}
+
+func (s *wrrState) indexOf(item string) int {
+	for i := 0; i < s.n; i++ {
+		if item == s.items[i].item {
+			return i
 		}
 	}
+	return -1
 }
 
 func (b *wrr) All() interface{} {
-	all := make(map[string]int)
-
-	b.Lock()
-	for k, v := range b.all {
+	s := b.load()
+	all := make(map[string]int, len(s.all))
+	for k, v := range s.all {
 		all[k] = v
 	}
-	b.Unlock()
-
 	return all
 }
 
@@ -93,88 +254,127 @@ func (b *wrr) Name() string {
 }
 
 func (b *wrr) Select(_ ...string) (item string) {
-	b.Lock()
-	switch b.n {
+	s := b.ramp(b.load())
+	switch s.n {
 	case 0:
 		item = ""
 	case 1:
-		if b.items[0].weight > 0 {
-			item = b.items[0].item
+		if s.items[0].weight > 0 {
+			item = s.items[0].item
 		}
 	default:
-		item = b.chooseNext().item
+		if c, _ := s.chooseNext(); c != nil {
+			item = c.item
+		}
 	}
-	b.Unlock()
 
 	return
 }
 
-func (b *wrr) chooseNext() *wrrItem {
+// chooseNext takes the steps of the sequence to the next selected item, and returns the step of it.
+func (s *wrrState) chooseNext() (*wrrItem, uint64) {
+	if s.max == 0 {
+		return nil, 0
+	}
 	for {
-		b.i = (b.i + 1) % b.n
-		if b.i == 0 {
-			b.cw = b.cw - b.gcd
-			if b.cw <= 0 {
-				b.cw = b.max
-				if b.cw == 0 {
-					return nil
-				}
-			}
+		k := atomic.AddUint64(&s.next, 1) - 1
+		if i, cw := s.at(k); s.items[i].eff >= cw {
+			return s.items[i], k
+		}
+	}
+}
+
+// SelectExcept gets next selected item other than the excluded items, the excluded ones are passed over in the sequence.
+func (b *wrr) SelectExcept(exclude []string, _ ...string) (item string) {
+	skip := excluded(exclude)
+	if skip == nil {
+		return b.Select()
+	}
+
+	s := b.ramp(b.load())
+	eligible := false
+	for _, x := range s.items {
+		if x.weight > 0 && !skip(x.item) {
+			eligible = true
+			break
+		}
+	}
+	if !eligible {
+		return
+	}
+	if s.n == 1 {
+		return s.items[0].item
+	}
+
+	for {
+		if c, _ := s.chooseNext(); !skip(c.item) {
+			return c.item
 		}
+	}
+}
+
+// SelectN gets up to n distinct items in the order of the sequence.
+func (b *wrr) SelectN(n int, _ ...string) []string {
+	s := b.ramp(b.load())
+	p := newPicker(n, s.n)
+	if p.full() || s.max == 0 {
+		return nil
+	}
+	if s.n == 1 {
+		p.add(s.items[0].item)
+		return p.result()
+	}
 
-		if b.items[b.i].weight >= b.cw {
-			return b.items[b.i]
+	c, k := s.chooseNext()
+	if c == nil {
+		return nil
+	}
+	p.add(c.item)
+
+	// a full period of the sequence visits every item with a positive weight
+	for steps := s.n * s.max / s.gcd; steps > 0 && !p.full(); steps-- {
+		k++
+		if i, cw := s.at(k); s.items[i].eff >= cw {
+			p.add(s.items[i].item)
 		}
 	}
+	return p.result()
 }
 
-func (b *wrr) Remove(item string, _ ...bool) bool {
+func (b *wrr) Remove(item string, _ ...bool) (ok bool) {
 	b.Lock()
 	defer b.Unlock()
 
-	return b.remove(item)
+	if ok = b.load().indexOf(item) >= 0; ok {
+		b.modify(func(s *wrrState) {
+			s.remove(item)
+		})
+	}
+	return
 }
 
-func (b *wrr) remove(item string) (ok bool) {
-	maxWeight := 0
-	for i := 0; i < b.n; i++ {
-		if item == b.items[i].item {
-			if b.max == b.items[i].weight {
-				b.max = maxWeight
-			}
-			b.items = append(b.items[:i], b.items[i+1:]...)
-			b.n--
-			delete(b.all, item)
-			ok = true
-			return
-		}
-		if b.items[i].weight > maxWeight {
-			maxWeight = b.items[i].weight
-		}
+func (s *wrrState) remove(item string) (ok bool) {
+	if i := s.indexOf(item); i >= 0 {
+		s.items = append(s.items[:i], s.items[i+1:]...)
+		s.n--
+		delete(s.all, item)
+		ok = true
 	}
 	return
 }
 
 func (b *wrr) RemoveAll() {
 	b.Lock()
-	b.removeAll()
+	b.state.Store(&wrrState{
+		all: make(map[string]int),
+	})
 	b.Unlock()
 }
 
-func (b *wrr) removeAll() {
-	b.items = b.items[:0]
-	b.n = 0
-	b.i = -1
-	b.cw = 0
-	b.gcd = 0
-	b.max = 0
-	b.all = make(map[string]int)
-}
-
 func (b *wrr) Reset() {
 	b.Lock()
-	b.i = -1
-	b.cw = 0
+	s := b.load().clone()
+	b.state.Store(s)
 	b.Unlock()
 }
 
@@ -187,28 +387,34 @@ func (b *wrr) Update(items interface{}) bool {
 	b.Lock()
 	defer b.Unlock()
 
-	b.n = len(v)
-	b.i = -1
-	b.cw = 0
-	b.gcd = 0
-	b.max = 0
-	b.all = v
-
-	if cap(b.items) >= b.n {
-		b.items = b.items[:b.n]
-	} else {
-		b.items = make([]*wrrItem, b.n)
+	old := b.load()
+	s := &wrrState{
+		items: make([]*wrrItem, 0, len(v)),
+		n:     len(v),
+		all:   make(map[string]int, len(v)),
 	}
-
-	i := 0
+	// the retained items keep the order and ramping up
+	for _, c := range old.items {
+		if weight, ok := v[c.item]; ok {
+			x := *c
+			x.weight = weight
+			s.items = append(s.items, &x)
+		}
+	}
+	// new items start to ramp up
 	for item, weight := range v {
-		b.items[i] = &wrrItem{
-			item:   item,
-			weight: weight,
+		if _, ok := old.all[item]; !ok {
+			s.items = append(s.items, &wrrItem{
+				item:   item,
+				weight: weight,
+				start:  b.ss.begin(),
+			})
 		}
-		b.addSettings(weight)
-		i++
+		s.all[item] = weight
 	}
+	b.refresh(s, b.ss.now())
+	s.rebase(old)
+	b.state.Store(s)
 
 	return true
 }
@@ -4,6 +4,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestWeightedRoundRobin(t *testing.T) {
@@ -96,6 +97,202 @@ func TestWeightedRoundRobin(t *testing.T) {
 	}
 }
 
+func TestWeightedRoundRobin_SelectN(t *testing.T) {
+	nodes := map[string]int{
+		"A": 0,
+		"B": 1,
+		"C": 7,
+		"D": 2,
+	}
+	lb := NewWeightedRoundRobin(nodes)
+	seq := NewWeightedRoundRobin()
+	for _, v := range lb.load().items {
+		seq.Add(v.item, v.weight)
+	}
+	for i := 0; i < 1000; i++ {
+		items := lb.SelectN(3)
+		if len(items) != 3 || items[0] != seq.Select() {
+			t.Fatalf("wrr select n wrong: %v", items)
+		}
+	}
+}
+
+func TestWeightedRoundRobin_SelectExcept(t *testing.T) {
+	nodes := map[string]int{
+		"A": 0,
+		"B": 1,
+		"C": 7,
+		"D": 2,
+	}
+	lb := NewWeightedRoundRobin(nodes)
+	count := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		count[lb.SelectExcept([]string{"C"})]++
+	}
+	if count["B"] != 100 || count["D"] != 200 {
+		t.Fatalf("wrr select except wrong: %v", count)
+	}
+
+	item := lb.SelectExcept([]string{"B", "C", "D"})
+	if item != "" {
+		t.Fatalf("wrr expected empty, actual %s", item)
+	}
+}
+
+func TestWeightedRoundRobin_SlowStart(t *testing.T) {
+	lb := NewWeightedRoundRobin(map[string]int{
+		"A": 1,
+		"B": 1,
+	})
+	lb.SetSlowStart(300 * time.Millisecond)
+	lb.Add("C", 1)
+	lb.Update(map[string]int{
+		"A": 1,
+		"B": 1,
+		"C": 1,
+		"D": 1,
+	})
+
+	// the new items get 10% of the weight at first
+	count := make(map[string]int)
+	for i := 0; i < 1100; i++ {
+		count[lb.Select()]++
+	}
+	if count["C"] > 100 || count["D"] > 100 || count["A"] < 400 || count["B"] < 400 {
+		t.Fatalf("wrr slow start wrong: %v", count)
+	}
+
+	// and the full weight at the end of the window
+	time.Sleep(310 * time.Millisecond)
+	count = make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		count[lb.Select()]++
+	}
+	for _, v := range count {
+		if v < 900 || v > 1100 {
+			t.Fatalf("wrr slow start wrong: %v", count)
+		}
+	}
+
+	// the items added later only
+	lb.SetSlowStart(0)
+	lb.Add("E", 4)
+	count = make(map[string]int)
+	for i := 0; i < 8000; i++ {
+		count[lb.Select()]++
+	}
+	if count["E"] < 3600 {
+		t.Fatalf("wrr slow start wrong: %v", count)
+	}
+}
+
+func TestWeightedRoundRobin_SlowStart_Step(t *testing.T) {
+	lb := NewWeightedRoundRobin(map[string]int{"A": 1})
+	lb.SetSlowStart(time.Hour)
+	lb.Add("B", 1)
+	s := lb.load()
+	if !s.ramped || s.due == 0 {
+		t.Fatal("wrr slow start step wrong")
+	}
+
+	// the weights are kept until the next step, Select does not wait for the writers
+	lb.Lock()
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			lb.Select()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("wrr slow start locked")
+	}
+	lb.Unlock()
+	if lb.load() != s {
+		t.Fatal("wrr slow start step wrong")
+	}
+}
+
+func TestWeightedRoundRobin_SetWeight(t *testing.T) {
+	nodes := map[string]int{
+		"A": 5,
+		"B": 1,
+		"C": 4,
+	}
+	lb := NewWeightedRoundRobin(nodes)
+	seq := NewWeightedRoundRobin()
+	for _, v := range lb.load().items {
+		seq.Add(v.item, v.weight)
+	}
+	for i := 0; i < 7; i++ {
+		if lb.Select() != seq.Select() {
+			t.Fatal("wrr wrong")
+		}
+	}
+
+	// the position in the sequence is kept
+	lb.SetWeight("B", 1)
+	for i := 0; i < 100; i++ {
+		if lb.Select() != seq.Select() {
+			t.Fatal("wrr set weight wrong")
+		}
+	}
+
+	lb.SetWeight("B", 5)
+	count := make(map[string]int)
+	for i := 0; i < 1400; i++ {
+		count[lb.Select()]++
+	}
+	if count["A"] != 500 || count["B"] != 500 || count["C"] != 400 {
+		t.Fatalf("wrr set weight wrong: %v", count)
+	}
+}
+
+func TestWeightedRoundRobin_Update(t *testing.T) {
+	nodes := map[string]int{
+		"A": 5,
+		"B": 1,
+		"C": 4,
+	}
+	lb := NewWeightedRoundRobin(nodes)
+	seq := NewWeightedRoundRobin()
+	for _, v := range lb.load().items {
+		seq.Add(v.item, v.weight)
+	}
+	for i := 0; i < 7; i++ {
+		if lb.Select() != seq.Select() {
+			t.Fatal("wrr wrong")
+		}
+	}
+
+	// the position in the sequence is kept
+	lb.Update(map[string]int{
+		"A": 5,
+		"B": 1,
+		"C": 4,
+	})
+	for i := 0; i < 100; i++ {
+		if lb.Select() != seq.Select() {
+			t.Fatal("wrr update wrong")
+		}
+	}
+
+	lb.Update(map[string]int{
+		"A": 5,
+		"C": 4,
+		"D": 1,
+	})
+	count := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		count[lb.Select()]++
+	}
+	if count["A"] != 500 || count["B"] != 0 || count["C"] != 400 || count["D"] != 100 {
+		t.Fatalf("wrr update wrong: %v", count)
+	}
+}
+
 func TestWeightedRoundRobin_C(t *testing.T) {
 	var (
 		a, b, c, d int64